@@ -0,0 +1,51 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"text/tabwriter"
+)
+
+// quota 命令，也作为 whoami 使用
+func (a *app) quota(ctx context.Context, flagSet *flag.FlagSet, args []string) error {
+	var input clientFlags
+	input.register(flagSet)
+	if _, err := parse(flagSet, args, 0, 0); err != nil {
+		return err
+	}
+	client, err := a.newClient(flagSet, &input)
+	if err != nil {
+		return err
+	}
+	userInfo, err := client.GetUserInfo(ctx)
+	if err != nil {
+		return err
+	}
+	quota, err := client.GetQuota(ctx)
+	if err != nil {
+		return err
+	}
+
+	if input.json() {
+		return json.NewEncoder(a.stdout).Encode(map[string]any{
+			"baidu_name":   userInfo.BaiduName,
+			"netdisk_name": userInfo.NetdiskName,
+			"uk":           userInfo.UK,
+			"vip_type":     userInfo.VipType,
+			"total":        quota.Total,
+			"used":         quota.Used,
+			"free":         quota.Free,
+		})
+	}
+	w := tabwriter.NewWriter(a.stdout, 0, 0, 1, ' ', 0)
+	fmt.Fprintf(w, "username:\t%s\n", userInfo.BaiduName)
+	fmt.Fprintf(w, "netdisk_name:\t%s\n", userInfo.NetdiskName)
+	fmt.Fprintf(w, "uk:\t%d\n", userInfo.UK)
+	fmt.Fprintf(w, "vip_type:\t%d (%s)\n", userInfo.VipType, userInfo.VipName())
+	fmt.Fprintf(w, "total:\t%s\n", humanSize(quota.Total))
+	fmt.Fprintf(w, "used:\t%s\n", humanSize(quota.Used))
+	fmt.Fprintf(w, "free:\t%s\n", humanSize(quota.Free))
+	return w.Flush()
+}
@@ -0,0 +1,96 @@
+package baidu_api
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+)
+
+// 会员类型
+const (
+	VipNone  = 0
+	VipBasic = 1
+	VipSuper = 2
+)
+
+// UserInfo 用户信息接口返回
+type UserInfo struct {
+	Errno       int       `json:"errno"`
+	Errmsg      string    `json:"errmsg"`
+	BaiduName   string    `json:"baidu_name"`
+	NetdiskName string    `json:"netdisk_name"`
+	AvatarURL   string    `json:"avatar_url"`
+	VipType     int       `json:"vip_type"`
+	UK          int64     `json:"uk"`
+	RequestID   RequestID `json:"request_id"`
+}
+
+func (r *UserInfo) apiError(endpoint string) error {
+	return checkErrno(endpoint, r.Errno, r.Errmsg, r.RequestID)
+}
+
+// VipName 会员类型的名字
+func (r *UserInfo) VipName() string {
+	switch r.VipType {
+	case VipNone:
+		return "普通用户"
+	case VipBasic:
+		return "普通会员"
+	case VipSuper:
+		return "超级会员"
+	}
+	return fmt.Sprintf("未知类型 %d", r.VipType)
+}
+
+// Quota 网盘容量接口返回，单位是字节
+type Quota struct {
+	Errno     int       `json:"errno"`
+	Total     int64     `json:"total"`
+	Used      int64     `json:"used"`
+	Free      int64     `json:"free"`
+	Expire    bool      `json:"expire"`
+	RequestID RequestID `json:"request_id"`
+}
+
+func (r *Quota) apiError(endpoint string) error {
+	return checkErrno(endpoint, r.Errno, "", r.RequestID)
+}
+
+// GetUserInfo 获取用户名、会员类型等账号信息
+func (c *Client) GetUserInfo(ctx context.Context) (*UserInfo, error) {
+	params := url.Values{}
+	params.Set("method", "uinfo")
+	var userInfo UserInfo
+	if err := getJSON(ctx, c, "nas/uinfo", c.panURL("/rest/2.0/xpan/nas", params), &userInfo); err != nil {
+		return nil, err
+	}
+	return &userInfo, nil
+}
+
+// GetQuota 获取网盘总空间、已用空间和剩余空间
+func (c *Client) GetQuota(ctx context.Context) (*Quota, error) {
+	params := url.Values{}
+	params.Set("checkfree", "1")
+	params.Set("checkexpire", "1")
+	var quota Quota
+	if err := getJSON(ctx, c, "quota", c.panURL("/api/quota", params), &quota); err != nil {
+		return nil, err
+	}
+	// 没有 checkfree 的老接口不返回 free
+	if quota.Free == 0 && quota.Total > quota.Used {
+		quota.Free = quota.Total - quota.Used
+	}
+	return &quota, nil
+}
+
+// CheckQuota 剩余空间放不下 size 字节时返回包装了 ErrQuotaExceeded 的错误
+func (c *Client) CheckQuota(ctx context.Context, size int64) error {
+	quota, err := c.GetQuota(ctx)
+	if err != nil {
+		return err
+	}
+	if size > quota.Free {
+		return fmt.Errorf("need %d bytes but only %d bytes free: %w", size, quota.Free, ErrQuotaExceeded)
+	}
+	return nil
+}
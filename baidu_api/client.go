@@ -0,0 +1,374 @@
+package baidu_api
+
+import (
+	"baidu_tool/utils"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultPanBaseURL 开放平台 xpan 接口的默认地址
+	DefaultPanBaseURL = "https://pan.baidu.com"
+	// DefaultPCSBaseURL 分片上传 superfile2 接口的默认地址
+	DefaultPCSBaseURL = "https://d.pcs.baidu.com"
+	// DefaultOAuthBaseURL 百度开放平台授权接口的默认地址
+	DefaultOAuthBaseURL = "https://openapi.baidu.com"
+	// DefaultUserAgent 百度要求下载和上传请求带上的 UA
+	DefaultUserAgent = "pan.baidu.com"
+)
+
+// Client 百度网盘接口的调用者，持有身份凭证、接口地址、HTTP 传输层和各种默认值，所有操作都挂在它上面
+// 作为库使用时可以把地址指向测试环境或假服务
+type Client struct {
+	// AccessToken 用户身份凭证，配置了 WithCredentials 时会被自动刷新，并发时请用 Token() 读取
+	AccessToken string
+	// PanBaseURL xpan 接口地址，如 https://pan.baidu.com
+	PanBaseURL string
+	// PCSBaseURL 分片上传接口地址，如 https://d.pcs.baidu.com
+	PCSBaseURL string
+	// OAuthBaseURL 授权接口地址，如 https://openapi.baidu.com
+	OAuthBaseURL string
+	// HTTPClient 所有请求共用的 http 客户端
+	HTTPClient *http.Client
+	// UserAgent 请求头中的 User-Agent
+	UserAgent string
+	// MaxConcurrent 上传下载时同时进行的网络请求数量上限
+	MaxConcurrent int
+	// ChunkSize 分片上传每片的大小
+	ChunkSize int64
+	// MaxSingleFileSize 单个网盘文件的大小上限，超过的本地文件拆成多个网盘文件上传
+	MaxSingleFileSize int64
+	// DownloadSliceSize 超过这个大小的文件分片下载
+	DownloadSliceSize int64
+	// DownloadDir 下载保存到的本地文件夹，为空时是当前目录
+	DownloadDir string
+	// DLinkTTL 下载地址缓存的时间，超过后下载分片前重新获取，为 0 时每次都重新获取
+	DLinkTTL time.Duration
+	// VerifyDownloads 下载完成后用网盘记录的 md5 核对内容，md5 不可靠的文件只核对大小
+	VerifyDownloads bool
+	// Output 进度条和提示信息的输出
+	Output io.Writer
+	// OnEvent 传输事件的处理函数，为 nil 时不发出事件
+	OnEvent func(TransferEvent)
+	// Limiters 按接口类别的限流器，默认是整个进程共用的 DefaultLimiters，不然百度容易拒绝请求
+	Limiters *Limiters
+	// Retry 接口请求和下载分片的重试策略
+	Retry RetryPolicy
+
+	dlinks          dlinkCache
+	eventMu         sync.Mutex
+	tokenMu         sync.Mutex
+	refreshMu       sync.Mutex
+	credentials     *Credentials
+	credentialStore CredentialStore
+
+	// refreshFailedAt 上一次提前刷新失败的时间，refreshRejected 授权接口拒绝了 refresh_token，都由 refreshMu 保护
+	refreshFailedAt time.Time
+	refreshRejected bool
+}
+
+// ClientOption 创建 Client 时的可选配置
+type ClientOption func(*Client)
+
+// WithPanBaseURL 替换 xpan 接口地址
+func WithPanBaseURL(baseURL string) ClientOption {
+	return func(c *Client) {
+		c.PanBaseURL = strings.TrimSuffix(baseURL, "/")
+	}
+}
+
+// WithPCSBaseURL 替换分片上传接口地址
+func WithPCSBaseURL(baseURL string) ClientOption {
+	return func(c *Client) {
+		c.PCSBaseURL = strings.TrimSuffix(baseURL, "/")
+	}
+}
+
+// WithOAuthBaseURL 替换授权接口地址
+func WithOAuthBaseURL(baseURL string) ClientOption {
+	return func(c *Client) {
+		c.OAuthBaseURL = strings.TrimSuffix(baseURL, "/")
+	}
+}
+
+// WithHTTPClient 替换 http 客户端，可用于自定义传输层、代理和超时
+func WithHTTPClient(httpClient *http.Client) ClientOption {
+	return func(c *Client) {
+		c.HTTPClient = httpClient
+	}
+}
+
+// WithUserAgent 替换请求头中的 User-Agent
+func WithUserAgent(userAgent string) ClientOption {
+	return func(c *Client) {
+		c.UserAgent = userAgent
+	}
+}
+
+// WithMaxConcurrent 设置上传下载的并发量
+func WithMaxConcurrent(n int) ClientOption {
+	return func(c *Client) {
+		c.MaxConcurrent = n
+	}
+}
+
+// WithChunkSize 设置分片上传每片的大小
+func WithChunkSize(size int64) ClientOption {
+	return func(c *Client) {
+		c.ChunkSize = size
+	}
+}
+
+// WithMaxSingleFileSize 设置单个网盘文件的大小上限
+func WithMaxSingleFileSize(size int64) ClientOption {
+	return func(c *Client) {
+		c.MaxSingleFileSize = size
+	}
+}
+
+// WithDownloadSliceSize 设置下载分片的大小
+func WithDownloadSliceSize(size int64) ClientOption {
+	return func(c *Client) {
+		c.DownloadSliceSize = size
+	}
+}
+
+// WithDownloadDir 设置下载保存到的本地文件夹
+func WithDownloadDir(dir string) ClientOption {
+	return func(c *Client) {
+		c.DownloadDir = dir
+	}
+}
+
+// WithDLinkTTL 设置下载地址缓存的时间
+func WithDLinkTTL(ttl time.Duration) ClientOption {
+	return func(c *Client) {
+		c.DLinkTTL = ttl
+	}
+}
+
+// WithVerifyDownloads 设置下载完成后是否核对 md5
+func WithVerifyDownloads(verify bool) ClientOption {
+	return func(c *Client) {
+		c.VerifyDownloads = verify
+	}
+}
+
+// WithOutput 设置进度条和提示信息的输出，如 io.Discard 关闭它们
+func WithOutput(w io.Writer) ClientOption {
+	return func(c *Client) {
+		c.Output = w
+	}
+}
+
+// WithLimiters 替换限流器，传入 nil 时不限流
+func WithLimiters(limiters *Limiters) ClientOption {
+	return func(c *Client) {
+		c.Limiters = limiters
+	}
+}
+
+// WithRetryPolicy 设置重试策略
+func WithRetryPolicy(policy RetryPolicy) ClientOption {
+	return func(c *Client) {
+		c.Retry = policy
+	}
+}
+
+// DefaultMaxConcurrent 默认的并发量，cpu 数量，最多 16
+func DefaultMaxConcurrent() int {
+	return min(runtime.NumCPU(), 16)
+}
+
+// NewClient 使用默认配置创建 Client
+func NewClient(accessToken string, opts ...ClientOption) *Client {
+	c := &Client{
+		AccessToken:       accessToken,
+		PanBaseURL:        DefaultPanBaseURL,
+		PCSBaseURL:        DefaultPCSBaseURL,
+		OAuthBaseURL:      DefaultOAuthBaseURL,
+		HTTPClient:        &http.Client{},
+		UserAgent:         DefaultUserAgent,
+		MaxConcurrent:     DefaultMaxConcurrent(),
+		ChunkSize:         utils.ChunkSize,
+		MaxSingleFileSize: utils.MaxSingleFileSize,
+		DownloadSliceSize: MB50,
+		DLinkTTL:          DefaultDLinkTTL,
+		VerifyDownloads:   true,
+		Output:            os.Stdout,
+		Limiters:          DefaultLimiters,
+		Retry:             DefaultRetryPolicy,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// panURL 拼接 xpan 接口地址，自动带上 access_token
+func (c *Client) panURL(path string, params url.Values) string {
+	return c.buildURL(c.PanBaseURL, path, params)
+}
+
+// pcsURL 拼接分片上传接口地址，自动带上 access_token
+func (c *Client) pcsURL(path string, params url.Values) string {
+	return c.buildURL(c.PCSBaseURL, path, params)
+}
+
+func (c *Client) buildURL(baseURL string, path string, params url.Values) string {
+	if params == nil {
+		params = url.Values{}
+	}
+	params.Set("access_token", c.Token())
+	return baseURL + path + "?" + params.Encode()
+}
+
+// newRequest 准备请求，带上每个请求都要带的请求头，并把 URL 中的 access_token 换成当前的
+func (c *Client) newRequest(ctx context.Context, method string, rawURL string, body io.Reader) (*http.Request, error) {
+	rawURL, err := c.withCurrentToken(ctx, rawURL)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, method, rawURL, body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", c.UserAgent)
+	return req, nil
+}
+
+// errnoResp 带错误码的接口返回
+type errnoResp interface {
+	apiError(endpoint string) error
+}
+
+// doRequest 按重试策略发起请求，每次尝试前都要经过限流器，并用 newReq 重新构建请求，解析返回到 respVar 并检查错误码
+func doRequest[T any](ctx context.Context, c *Client, limiter *RateLimiter, endpoint string, newReq func() (*http.Request, error), respVar *T) error {
+	// attempt 发起一次请求，同时返回这次使用的 access_token
+	attempt := func() (string, error) {
+		if err := limiter.Wait(ctx); err != nil {
+			return "", err
+		}
+		// 每次尝试前清空上一次的返回，避免残留的字段
+		var zero T
+		*respVar = zero
+		req, err := newReq()
+		if err != nil {
+			return "", err
+		}
+		usedToken := req.URL.Query().Get("access_token")
+		_, err = utils.DoHttpRequest(respVar, c.httpClient(), req)
+		if checker, ok := any(respVar).(errnoResp); ok {
+			// 状态码出错时返回体里的错误码更有意义
+			if apiErr := checker.apiError(endpoint); apiErr != nil {
+				err = apiErr
+			}
+		}
+		if isRateLimited(err) {
+			limiter.SlowDown()
+		}
+		return usedToken, err
+	}
+	return c.Retry.Do(ctx, func() error {
+		usedToken, err := attempt()
+		if usedToken == "" || !errors.Is(err, ErrTokenExpired) || !c.canRefresh() {
+			return err
+		}
+		// token 过期，刷新后马上再试一次
+		if refreshErr := c.refreshToken(ctx, usedToken); refreshErr != nil {
+			return errors.Join(err, refreshErr)
+		}
+		_, err = attempt()
+		return err
+	})
+}
+
+// getJSON 发起 GET 请求
+func getJSON[T any](ctx context.Context, c *Client, endpoint string, rawURL string, respVar *T) error {
+	return doRequest(ctx, c, c.metadataLimiter(), endpoint, func() (*http.Request, error) {
+		return c.newRequest(ctx, "GET", rawURL, nil)
+	}, respVar)
+}
+
+// postForm 发起表单 POST 请求
+func postForm[T any](ctx context.Context, c *Client, endpoint string, rawURL string, form url.Values, respVar *T) error {
+	body := form.Encode()
+	return doRequest(ctx, c, c.metadataLimiter(), endpoint, func() (*http.Request, error) {
+		req, err := c.newRequest(ctx, "POST", rawURL, strings.NewReader(body))
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		return req, nil
+	}, respVar)
+}
+
+// httpClient 没有配置时退回到默认 http 客户端
+func (c *Client) httpClient() *http.Client {
+	if c.HTTPClient == nil {
+		return http.DefaultClient
+	}
+	return c.HTTPClient
+}
+
+// output 进度条和提示信息的输出，没有配置时是标准输出
+func (c *Client) output() io.Writer {
+	if c.Output == nil {
+		return os.Stdout
+	}
+	return c.Output
+}
+
+// metadataLimiter 元数据接口的限流器，没有配置时返回 nil 表示不限流
+func (c *Client) metadataLimiter() *RateLimiter {
+	if c.Limiters == nil {
+		return nil
+	}
+	return c.Limiters.Metadata
+}
+
+// uploadLimiter 分片上传的限流器
+func (c *Client) uploadLimiter() *RateLimiter {
+	if c.Limiters == nil {
+		return nil
+	}
+	return c.Limiters.Upload
+}
+
+// downloadLimiter 下载的限流器
+func (c *Client) downloadLimiter() *RateLimiter {
+	if c.Limiters == nil {
+		return nil
+	}
+	return c.Limiters.Download
+}
+
+// sleepContext 可以被 ctx 打断的 sleep
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// acquire 占用一个并行量，ctx 被取消时放弃
+func acquire(ctx context.Context, limitChan chan struct{}) error {
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case limitChan <- struct{}{}:
+		return nil
+	}
+}
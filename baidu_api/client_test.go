@@ -0,0 +1,642 @@
+package baidu_api_test
+
+import (
+	"baidu_tool/baidu_api"
+	"baidu_tool/baidu_api/fakepan"
+	"baidu_tool/utils"
+	"bytes"
+	"context"
+	"crypto/md5"
+	"errors"
+	"fmt"
+	"github.com/vbauerster/mpb"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testToken = "test-token"
+
+// newTestClient 启动假服务并返回指向它的 Client
+func newTestClient(t *testing.T) (*fakepan.Server, *baidu_api.Client) {
+	t.Helper()
+	server := fakepan.NewServer(testToken)
+	t.Cleanup(server.Close)
+	client := baidu_api.NewClient(testToken,
+		baidu_api.WithPanBaseURL(server.URL),
+		baidu_api.WithPCSBaseURL(server.URL),
+		baidu_api.WithLimiters(nil),
+	)
+	return server, client
+}
+
+// chdir 切换到临时工作目录，上传下载都使用相对路径
+func chdir(t *testing.T, dir string) {
+	t.Helper()
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		_ = os.Chdir(wd)
+	})
+}
+
+// patternBytes 生成有规律的内容，方便发现错位
+func patternBytes(size int) []byte {
+	b := make([]byte, size)
+	for i := range b {
+		b[i] = byte(i*7 + i/4096)
+	}
+	return b
+}
+
+func md5Hex(data []byte) string {
+	return fmt.Sprintf("%x", md5.Sum(data))
+}
+
+func writeLocalFile(t *testing.T, name string, data []byte) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(name), 0750); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(name, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestUploadThenDownload(t *testing.T) {
+	server, client := newTestClient(t)
+	chdir(t, t.TempDir())
+
+	files := map[string][]byte{
+		"data/a.txt":     []byte("hello baidu"),
+		"data/sub/b.bin": patternBytes(9*1024*1024 + 17),
+	}
+	var localPaths []string
+	for name, data := range files {
+		writeLocalFile(t, name, data)
+		localPaths = append(localPaths, name)
+	}
+
+	if err := client.UploadFileOrDir(context.Background(), localPaths, "tool", mpb.New()); err != nil {
+		t.Fatalf("upload: %v", err)
+	}
+	for name, data := range files {
+		got, ok := server.ReadFile("/apps/tool/" + name)
+		if !ok {
+			t.Fatalf("%s not uploaded", name)
+		}
+		if !bytes.Equal(got, data) {
+			t.Fatalf("%s uploaded content mismatch", name)
+		}
+	}
+
+	if err := os.RemoveAll("data"); err != nil {
+		t.Fatal(err)
+	}
+	dirResp, err := client.GetFileOrDirResp(context.Background(), "/apps/tool/data", 0)
+	if err != nil {
+		t.Fatalf("listall: %v", err)
+	}
+	if err = client.DownloadFileOrDir(context.Background(), dirResp.List, "/apps/tool"); err != nil {
+		t.Fatalf("download: %v", err)
+	}
+	for name, data := range files {
+		got, err := os.ReadFile(name)
+		if err != nil {
+			t.Fatalf("%s not downloaded: %v", name, err)
+		}
+		if !bytes.Equal(got, data) {
+			t.Fatalf("%s downloaded content mismatch", name)
+		}
+	}
+}
+
+func TestDownloadSlicedFile(t *testing.T) {
+	server, client := newTestClient(t)
+	chdir(t, t.TempDir())
+
+	data := patternBytes(baidu_api.MB50 + 1234)
+	server.PutFile("/apps/tool/big.bin", data)
+
+	dirResp, err := client.GetDirByList(context.Background(), "/apps/tool")
+	if err != nil {
+		t.Fatalf("list: %v", err)
+	}
+	if err = client.DownloadFileOrDir(context.Background(), dirResp.List, "/apps/tool"); err != nil {
+		t.Fatalf("download: %v", err)
+	}
+	got, err := os.ReadFile("big.bin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, data) {
+		t.Fatalf("sliced download content mismatch, got %d bytes", len(got))
+	}
+	if n := server.Requests("download"); n != 2 {
+		t.Fatalf("expected 2 ranged requests, got %d", n)
+	}
+}
+
+func TestConfiguredSizes(t *testing.T) {
+	server, client := newTestClient(t)
+	chdir(t, t.TempDir())
+	client.ChunkSize = 1024
+	client.MaxSingleFileSize = 4096
+	client.DownloadSliceSize = 3072
+	client.DownloadDir = "out"
+
+	// 拆成 4096、4096、2053 三个网盘文件，每个按 1KB 分片上传
+	data := patternBytes(10245)
+	writeLocalFile(t, "data/x.bin", data)
+	if err := client.UploadFileOrDir(context.Background(), []string{"data/x.bin"}, "tool", mpb.New()); err != nil {
+		t.Fatalf("upload: %v", err)
+	}
+	if n := server.Requests("upload"); n != 11 {
+		t.Fatalf("expected 11 chunks, got %d", n)
+	}
+	for i, part := range [][]byte{data[:4096], data[4096:8192], data[8192:]} {
+		got, ok := server.ReadFile(fmt.Sprintf("/apps/tool/data/x.bin/%d", i+1))
+		if !ok || !bytes.Equal(got, part) {
+			t.Fatalf("part %d uploaded content mismatch", i+1)
+		}
+	}
+
+	dirResp, err := client.GetDirByList(context.Background(), "/apps/tool/data/x.bin")
+	if err != nil {
+		t.Fatalf("list: %v", err)
+	}
+	if err = client.DownloadFileOrDir(context.Background(), dirResp.List[:1], "/apps/tool"); err != nil {
+		t.Fatalf("download: %v", err)
+	}
+	got, err := os.ReadFile("out/data/x.bin/1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, data[:4096]) {
+		t.Fatal("downloaded content mismatch")
+	}
+	if n := server.Requests("download"); n != 2 {
+		t.Fatalf("expected 2 ranged requests, got %d", n)
+	}
+}
+
+func TestUploadStopsOnFatalError(t *testing.T) {
+	server, client := newTestClient(t)
+	chdir(t, t.TempDir())
+
+	var localPaths []string
+	for _, name := range []string{"a.txt", "b.txt", "c.txt"} {
+		writeLocalFile(t, name, []byte(name))
+		localPaths = append(localPaths, name)
+	}
+	server.Fail("precreate", 1, 0, -10)
+
+	err := client.UploadFileOrDir(context.Background(), localPaths, "tool", mpb.New())
+	if !errors.Is(err, baidu_api.ErrQuotaExceeded) {
+		t.Fatalf("expected ErrQuotaExceeded, got %v", err)
+	}
+}
+
+func TestCancelledDownload(t *testing.T) {
+	server, client := newTestClient(t)
+	chdir(t, t.TempDir())
+	server.PutFile("/apps/tool/a.txt", []byte("content"))
+
+	dirResp, err := client.GetDirByList(context.Background(), "/apps/tool")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err = client.DownloadFileOrDir(ctx, dirResp.List, "/apps/tool"); !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+	if _, err = os.Stat("a.txt"); !os.IsNotExist(err) {
+		t.Fatalf("cancelled download should not leave files, stat err: %v", err)
+	}
+}
+
+func TestListDirPagination(t *testing.T) {
+	server, client := newTestClient(t)
+	for i := 0; i < 12; i++ {
+		server.PutFile(fmt.Sprintf("/apps/many/f%02d.txt", i), []byte("x"))
+	}
+	// 服务端每页最多给 5 个，比要求的 10 个少，也要取完
+	server.SetListPageCap(5)
+	list, err := client.ListDir(context.Background(), "/apps/many", baidu_api.ListOptions{PageSize: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 12 || list[11].ServerFilename != "f11.txt" {
+		t.Fatalf("expected 12 entries, got %d", len(list))
+	}
+	if n := server.Requests("list"); n != 3 {
+		t.Fatalf("expected 3 list requests, got %d", n)
+	}
+}
+
+func TestListAllPagination(t *testing.T) {
+	server, client := newTestClient(t)
+	for i := 0; i < 12; i++ {
+		server.PutFile(fmt.Sprintf("/apps/big/d%d/f%02d.txt", i%3, i), []byte("x"))
+	}
+	// 12 个文件加 3 个文件夹，每次 4 个要请求 4 次
+	it := client.ListAll(context.Background(), "/apps/big", 4)
+	seen := map[string]bool{}
+	for it.Next() {
+		seen[it.Item().Path] = true
+	}
+	if err := it.Err(); err != nil {
+		t.Fatal(err)
+	}
+	if len(seen) != 15 || !seen["/apps/big/d2/f11.txt"] {
+		t.Fatalf("expected 15 entries, got %d", len(seen))
+	}
+	if n := server.Requests("listall"); n != 4 {
+		t.Fatalf("expected 4 listall requests, got %d", n)
+	}
+
+	dirResp, err := client.GetFileOrDirResp(context.Background(), "/apps/big", 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(dirResp.List) != 15 {
+		t.Fatalf("expected 15 entries, got %d", len(dirResp.List))
+	}
+
+	it = client.ListAll(context.Background(), "/apps/missing", 0)
+	if it.Next() || !errors.Is(it.Err(), baidu_api.ErrPathNotFound) {
+		t.Fatalf("expected not found, got %v", it.Err())
+	}
+}
+
+func TestSearch(t *testing.T) {
+	server, client := newTestClient(t)
+	for i := 0; i < 7; i++ {
+		server.PutFile(fmt.Sprintf("/apps/photos/%d/Holiday-%d.jpg", i, i), []byte("x"))
+	}
+	server.PutFile("/apps/photos/holiday.mp4", []byte("x"))
+	server.PutFile("/apps/other/holiday.jpg", []byte("x"))
+
+	list, err := client.Search(context.Background(), "holiday", baidu_api.SearchOptions{Dir: "/apps/photos", Recursion: true, Category: 3, PageSize: 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 7 {
+		t.Fatalf("expected 7 pictures, got %d", len(list))
+	}
+	if n := server.Requests("search"); n != 3 {
+		t.Fatalf("expected 3 pages, got %d", n)
+	}
+
+	list, err = client.Search(context.Background(), "holiday", baidu_api.SearchOptions{Dir: "/apps/photos"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 1 || list[0].Path != "/apps/photos/holiday.mp4" {
+		t.Fatalf("expected only the top level video, got %+v", list)
+	}
+}
+
+func TestFileMetas(t *testing.T) {
+	server, client := newTestClient(t)
+	var fsIDList []int64
+	for i := 0; i < 150; i++ {
+		fsIDList = append(fsIDList, server.PutFile(fmt.Sprintf("/apps/many/%03d.jpg", i), []byte("x")).FsID)
+	}
+	metas, err := client.FileMetas(context.Background(), fsIDList, baidu_api.FileMetasOptions{Thumb: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(metas) != 150 || metas[0].Thumbs["icon"] == "" {
+		t.Fatalf("expected 150 metas with thumbs, got %d", len(metas))
+	}
+	if n := server.Requests("filemetas"); n != 2 {
+		t.Fatalf("expected 2 batches, got %d", n)
+	}
+
+	f := server.PutFile("/apps/other/a.txt", []byte("hello"))
+	metas, err = client.StatPaths(context.Background(), []string{"/apps/other/a.txt", "/apps/many/007.jpg"}, baidu_api.FileMetasOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if metas[0].FsID != f.FsID || metas[0].MD5 != f.MD5 || metas[0].Size != 5 || metas[1].Filename != "007.jpg" {
+		t.Fatalf("unexpected metas: %+v %+v", metas[0], metas[1])
+	}
+	if _, err = client.StatPaths(context.Background(), []string{"/apps/other/missing"}, baidu_api.FileMetasOptions{}); !errors.Is(err, baidu_api.ErrPathNotFound) {
+		t.Fatalf("expected not found, got %v", err)
+	}
+}
+
+func TestDownloadResumesCompletedRanges(t *testing.T) {
+	server, client := newTestClient(t)
+	chdir(t, t.TempDir())
+	client.DownloadSliceSize = 1024
+	data := patternBytes(3000)
+	server.PutFile("/apps/tool/r.bin", data)
+	dirResp, err := client.GetDirByList(context.Background(), "/apps/tool")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 模拟上次下载中断：记录里第 0、1 个分片都完成了，但第 1 个分片崩溃前没有真正写进 .part 文件
+	item := dirResp.List[0]
+	journal := func(fileMD5 string, rangeSize int) []byte {
+		return []byte(fmt.Sprintf(`{"fs_id":%d,"size":3000,"md5":%q,"range_size":%d,"ranges":[{"index":0,"md5":%q},{"index":1,"md5":%q}]}`,
+			item.FsId, fileMD5, rangeSize, md5Hex(data[:1024]), md5Hex(data[1024:2048])))
+	}
+	part := make([]byte, len(data))
+	copy(part, data[:1024])
+	writeLocalFile(t, "r.bin.part", part)
+	writeLocalFile(t, "r.bin.part.json", journal(item.MD5, 1024))
+	if err = client.DownloadFileOrDir(context.Background(), dirResp.List, "/apps/tool"); err != nil {
+		t.Fatalf("download: %v", err)
+	}
+	if n := server.Requests("download"); n != 2 {
+		t.Fatalf("expected the unverified and remaining ranges, got %d requests", n)
+	}
+	got, err := os.ReadFile("r.bin")
+	if err != nil || !bytes.Equal(got, data) {
+		t.Fatalf("resumed content mismatch: %v", err)
+	}
+	for _, name := range []string{"r.bin.part", "r.bin.part.json"} {
+		if _, err = os.Stat(name); !os.IsNotExist(err) {
+			t.Fatalf("%s should be removed after download, stat err: %v", name, err)
+		}
+	}
+
+	// 网盘文件变了或者分片大小不同，记录不能用，重新下载全部分片
+	for _, stale := range [][]byte{journal("0123456789abcdef0123456789abcdef", 1024), journal(item.MD5, 2048)} {
+		if err = os.Remove("r.bin"); err != nil {
+			t.Fatal(err)
+		}
+		writeLocalFile(t, "r.bin.part", part)
+		writeLocalFile(t, "r.bin.part.json", stale)
+		if err = client.DownloadFileOrDir(context.Background(), dirResp.List, "/apps/tool"); err != nil {
+			t.Fatalf("download: %v", err)
+		}
+	}
+	if n := server.Requests("download"); n != 8 {
+		t.Fatalf("expected 3 more ranges per restart, got %d requests in total", n)
+	}
+	if got, err = os.ReadFile("r.bin"); err != nil || !bytes.Equal(got, data) {
+		t.Fatalf("restarted content mismatch: %v", err)
+	}
+}
+
+func TestDownloadVerifiesMD5(t *testing.T) {
+	server, client := newTestClient(t)
+	chdir(t, t.TempDir())
+	server.PutFile("/apps/tool/ok.txt", []byte("hello"))
+	server.PutFile("/apps/tool/bad.txt", []byte("world"))
+	server.SetMD5("/apps/tool/bad.txt", md5Hex([]byte("other")))
+	dirResp, err := client.GetDirByList(context.Background(), "/apps/tool")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = client.DownloadFileOrDir(context.Background(), dirResp.List, "/apps/tool")
+	if !errors.Is(err, baidu_api.ErrChecksumMismatch) {
+		t.Fatalf("expected checksum mismatch, got %v", err)
+	}
+	// 核对不通过的文件不留下，下次从头下载
+	for _, name := range []string{"bad.txt", "bad.txt.part", "bad.txt.part.json"} {
+		if _, err = os.Stat(name); !os.IsNotExist(err) {
+			t.Fatalf("%s should not exist, stat err: %v", name, err)
+		}
+	}
+
+	client.VerifyDownloads = false
+	if err = client.DownloadFileOrDir(context.Background(), dirResp.List, "/apps/tool"); err != nil {
+		t.Fatalf("download without verify: %v", err)
+	}
+	if status, err := baidu_api.VerifyLocalFile("ok.txt", 5, md5Hex([]byte("hello")), nil); err != nil || status != baidu_api.VerifyOK {
+		t.Fatalf("ok.txt: %s %v", status, err)
+	}
+	if status, err := baidu_api.VerifyLocalFile("bad.txt", 5, md5Hex([]byte("other")), nil); err != nil || status != baidu_api.VerifyMismatch {
+		t.Fatalf("bad.txt: %s %v", status, err)
+	}
+}
+
+func TestDownloadContinuesAfterFailedFile(t *testing.T) {
+	server, client := newTestClient(t)
+	client.Retry = baidu_api.RetryPolicy{MaxAttempts: 2}
+	client.MaxConcurrent = 1
+	chdir(t, t.TempDir())
+	server.PutFile("/apps/tool/a.txt", []byte("first"))
+	server.PutFile("/apps/tool/b.txt", []byte("second"))
+	dirResp, err := client.GetDirByList(context.Background(), "/apps/tool")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 只有一个并发时按顺序下载，第一个文件用完重试次数后放弃，第二个文件照常下载
+	server.Fail("download", 2, http.StatusServiceUnavailable, 0)
+	err = client.DownloadFileOrDir(context.Background(), dirResp.List, "/apps/tool")
+	var downloadErr *baidu_api.DownloadError
+	if !errors.As(err, &downloadErr) {
+		t.Fatalf("expected DownloadError, got %v", err)
+	}
+	if downloadErr.Total != 2 || len(downloadErr.Failures) != 1 || downloadErr.Failures[0].Path != "/apps/tool/a.txt" {
+		t.Fatalf("unexpected failures: %v", err)
+	}
+	if !strings.Contains(err.Error(), "/apps/tool/a.txt: http status 503") {
+		t.Fatalf("error should list the failed file and why: %v", err)
+	}
+	if got, err := os.ReadFile("b.txt"); err != nil || string(got) != "second" {
+		t.Fatalf("b.txt should be downloaded: %q %v", got, err)
+	}
+	if _, err = os.Stat("a.txt"); !os.IsNotExist(err) {
+		t.Fatalf("failed file should not be saved, stat err: %v", err)
+	}
+
+	if err = client.DownloadFileOrDir(context.Background(), dirResp.List, "/apps/tool"); err != nil {
+		t.Fatalf("retry download: %v", err)
+	}
+}
+
+func TestDownloadRefreshesExpiredDLink(t *testing.T) {
+	server, client := newTestClient(t)
+	client.Retry = baidu_api.RetryPolicy{MaxAttempts: 3}
+	client.DownloadSliceSize = 1024
+	client.MaxConcurrent = 1
+	chdir(t, t.TempDir())
+	data := patternBytes(3000)
+	server.PutFile("/apps/tool/a.bin", data)
+	dirResp, err := client.GetDirByList(context.Background(), "/apps/tool")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 下载地址在下载文件时才获取，同一个文件的分片共用，第一个分片下载完后地址过期
+	server.ExpireDLinks(1)
+	if err = client.DownloadFileOrDir(context.Background(), dirResp.List, "/apps/tool"); err != nil {
+		t.Fatalf("download with an expired dlink: %v", err)
+	}
+	if got, err := os.ReadFile("a.bin"); err != nil || !bytes.Equal(got, data) {
+		t.Fatalf("content mismatch: %v", err)
+	}
+	// 过期的地址只被用了一次，被拒绝后换成新的地址下载剩下的分片
+	if n := server.Requests("dlink_expired"); n != 1 {
+		t.Fatalf("expected the stale dlink to be rejected once, got %d", n)
+	}
+	if n := server.Requests("filemetas"); n != 3 {
+		t.Fatalf("expected one info and two dlink requests, got %d filemetas requests", n)
+	}
+	if n := server.Requests("download"); n != 4 {
+		t.Fatalf("expected one rejected range request, got %d download requests", n)
+	}
+
+	// 文件下载完后缓存就丢掉了，再下载时重新获取
+	if err = os.Remove("a.bin"); err != nil {
+		t.Fatal(err)
+	}
+	if err = client.DownloadFileOrDir(context.Background(), dirResp.List, "/apps/tool"); err != nil {
+		t.Fatalf("download: %v", err)
+	}
+	if n := server.Requests("filemetas"); n != 5 {
+		t.Fatalf("expected a fresh dlink for the new download, got %d filemetas requests", n)
+	}
+
+	// 缓存时间到了每个分片都重新获取
+	client.DLinkTTL = 0
+	if err = os.Remove("a.bin"); err != nil {
+		t.Fatal(err)
+	}
+	if err = client.DownloadFileOrDir(context.Background(), dirResp.List, "/apps/tool"); err != nil {
+		t.Fatalf("download: %v", err)
+	}
+	if n := server.Requests("filemetas"); n != 9 {
+		t.Fatalf("expected a dlink per range after ttl, got %d filemetas requests", n)
+	}
+}
+
+func TestDownloadEmptyFile(t *testing.T) {
+	server, client := newTestClient(t)
+	chdir(t, t.TempDir())
+	server.PutFile("/apps/tool/empty.txt", nil)
+	server.PutFile("/apps/tool/dir/empty.txt", nil)
+	server.PutFile("/apps/tool/dir/a.txt", []byte("a"))
+
+	// 大小为 0 的文件曾经让进度条永远不结束，超时就是卡住了
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	dirResp, err := client.GetDirByList(ctx, "/apps/tool")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, item := range dirResp.List {
+		if item.ServerFilename == "empty.txt" {
+			if err = client.DownloadFileOrDir(ctx, []*baidu_api.FileOrDir{item}, "/apps/tool"); err != nil {
+				t.Fatalf("download empty file: %v", err)
+			}
+		}
+	}
+	dirFiles, err := client.GetFileOrDirResp(ctx, "/apps/tool/dir", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = client.DownloadFileOrDir(ctx, dirFiles.List, "/apps/tool"); err != nil {
+		t.Fatalf("download dir with an empty file: %v", err)
+	}
+	for name, want := range map[string]string{"empty.txt": "", "dir/empty.txt": "", "dir/a.txt": "a"} {
+		if got, err := os.ReadFile(name); err != nil || string(got) != want {
+			t.Fatalf("%s: %q %v", name, got, err)
+		}
+		if _, err = os.Stat(name + ".part"); !os.IsNotExist(err) {
+			t.Fatalf("%s.part should be removed, stat err: %v", name, err)
+		}
+	}
+}
+
+func TestDownloadVerifiesExistingFile(t *testing.T) {
+	server, client := newTestClient(t)
+	chdir(t, t.TempDir())
+	server.PutFile("/apps/tool/a.txt", []byte("hello"))
+	dirResp, err := client.GetDirByList(context.Background(), "/apps/tool")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 大小一样但内容不对的已有文件重新下载
+	writeLocalFile(t, "a.txt", []byte("HELLO"))
+	if err = client.DownloadFileOrDir(context.Background(), dirResp.List, "/apps/tool"); err != nil {
+		t.Fatalf("download: %v", err)
+	}
+	if got, err := os.ReadFile("a.txt"); err != nil || string(got) != "hello" {
+		t.Fatalf("existing file should be replaced: %q %v", got, err)
+	}
+	if n := server.Requests("download"); n != 1 {
+		t.Fatalf("expected 1 download request, got %d", n)
+	}
+
+	// 分多块上传的文件网盘的 md5 不可靠，只核对大小
+	writeLocalFile(t, "a.txt", []byte("HELLO"))
+	if status, err := baidu_api.VerifyLocalFile("a.txt", 5, md5Hex([]byte("hello")), []string{"x", "y"}); err != nil || status != baidu_api.VerifySizeOnly {
+		t.Fatalf("a.txt: %s %v", status, err)
+	}
+	// 下载用的 Client 的分片大小和上传时的无关，不影响核对
+	client.ChunkSize = 4
+	if status, err := baidu_api.VerifyLocalFile("a.txt", 5, md5Hex([]byte("hello")), nil); err != nil || status != baidu_api.VerifyMismatch {
+		t.Fatalf("a.txt: %s %v", status, err)
+	}
+}
+
+func TestReliableMD5(t *testing.T) {
+	checksum := md5Hex([]byte("hello"))
+	tests := []struct {
+		md5       string
+		size      int64
+		blockList []string
+		want      bool
+	}{
+		{md5: checksum, size: 5, want: true},
+		{md5: checksum, size: utils.ChunkSize, want: true},
+		{md5: checksum, size: utils.ChunkSize + 1, want: false},
+		{md5: checksum, size: 5, blockList: []string{checksum}, want: true},
+		{md5: checksum, size: 5, blockList: []string{checksum, checksum}, want: false},
+		{md5: checksum, size: utils.ChunkSize * 3, blockList: []string{checksum}, want: true},
+		{md5: "not-a-md5", size: 5, want: false},
+		{md5: "", size: 0, want: false},
+	}
+	for _, tt := range tests {
+		if got := baidu_api.ReliableMD5(tt.md5, tt.size, tt.blockList); got != tt.want {
+			t.Errorf("ReliableMD5(%q, %d, %v) = %v, want %v", tt.md5, tt.size, tt.blockList, got, tt.want)
+		}
+	}
+}
+
+func TestDownloadSkipsMD5OfMultiBlockUpload(t *testing.T) {
+	server, client := newTestClient(t)
+	chdir(t, t.TempDir())
+	// 按 4 字节分片上传，网盘记录了 3 个分块
+	client.ChunkSize = 4
+	writeLocalFile(t, "data/a.txt", []byte("0123456789"))
+	if err := client.UploadFileOrDir(context.Background(), []string{"data/a.txt"}, "tool", mpb.New()); err != nil {
+		t.Fatal(err)
+	}
+	// 分块上传的文件网盘的 md5 不是内容的 md5
+	server.SetMD5("/apps/tool/data/a.txt", md5Hex([]byte("something else")))
+	dirResp, err := client.GetDirByList(context.Background(), "/apps/tool/data")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 下载的 Client 分片大小是多少都只核对大小
+	client.ChunkSize = utils.ChunkSize
+	client.DownloadDir = "out"
+	if err = client.DownloadFileOrDir(context.Background(), dirResp.List, "/apps/tool"); err != nil {
+		t.Fatalf("download of a multi-block upload: %v", err)
+	}
+	if got, err := os.ReadFile("out/data/a.txt"); err != nil || string(got) != "0123456789" {
+		t.Fatalf("content: %q %v", got, err)
+	}
+}
@@ -0,0 +1,54 @@
+package baidu_api
+
+import (
+	"context"
+	"encoding/json"
+	"net/url"
+	"strconv"
+)
+
+type CreateParam struct {
+	Path      string   `json:"path"`
+	Size      string   `json:"size"`
+	IsDir     string   `json:"isdir"`
+	BlockList []string `json:"block_list"`
+	UploadId  string   `json:"uploadid"`
+	RType     int      `json:"rtype"`
+}
+
+type CreateReturn struct {
+	Errno     int       `json:"errno"`
+	Errmsg    string    `json:"errmsg"`
+	Path      string    `json:"path"`
+	FsID      int64     `json:"fs_id"`
+	RequestID RequestID `json:"request_id"`
+}
+
+func (r *CreateReturn) apiError(endpoint string) error {
+	return checkErrno(endpoint, r.Errno, r.Errmsg, r.RequestID)
+}
+
+func (c *Client) Create(ctx context.Context, baiduFilePath string, size int64, blockList []string, UploadId string) (*CreateReturn, error) {
+	ret := &CreateReturn{}
+
+	params := url.Values{}
+	params.Set("method", "create")
+	realUrl := c.panURL("/rest/2.0/xpan/file", params)
+
+	body := url.Values{}
+	body.Add("path", baiduFilePath)
+	body.Add("size", strconv.FormatInt(size, 10))
+	body.Add("isdir", "0")
+	bts, err := json.Marshal(blockList)
+	if err != nil {
+		return nil, err
+	}
+	body.Add("block_list", string(bts))
+	body.Add("uploadid", UploadId)
+	body.Add("rtype", "2")
+
+	if err = postForm(ctx, c, "file/create", realUrl, body, ret); err != nil {
+		return ret, err
+	}
+	return ret, nil
+}
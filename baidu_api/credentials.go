@@ -0,0 +1,132 @@
+package baidu_api
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/url"
+	"time"
+)
+
+// tokenRefreshMargin access_token 剩余有效期少于这个时间就提前刷新，避免长时间传输中途过期
+const tokenRefreshMargin = 24 * time.Hour
+
+// tokenRefreshCooldown 提前刷新失败后隔多久再试，避免每个请求都去请求一次授权接口
+const tokenRefreshCooldown = 10 * time.Minute
+
+// CredentialStore 保存凭证的地方，刷新 access_token 后新的凭证会写回去
+type CredentialStore interface {
+	Load() (*Credentials, error)
+	Save(credentials *Credentials) error
+}
+
+// WithCredentials 使用带 refresh_token 的凭证，快过期或接口返回 token 过期时自动刷新，刷新后保存到 store，store 可以为 nil
+func WithCredentials(credentials *Credentials, store CredentialStore) ClientOption {
+	return func(c *Client) {
+		c.AccessToken = credentials.AccessToken
+		c.credentials = credentials
+		c.credentialStore = store
+	}
+}
+
+// Token 当前的 access_token，刷新后会变
+func (c *Client) Token() string {
+	c.tokenMu.Lock()
+	defer c.tokenMu.Unlock()
+	return c.AccessToken
+}
+
+// Credentials 当前的凭证，没有通过 WithCredentials 配置时只有 AccessToken
+func (c *Client) Credentials() Credentials {
+	c.tokenMu.Lock()
+	defer c.tokenMu.Unlock()
+	if c.credentials == nil {
+		return Credentials{AccessToken: c.AccessToken}
+	}
+	return *c.credentials
+}
+
+// canRefresh 有 refresh_token 和应用密钥时才能刷新
+func (c *Client) canRefresh() bool {
+	credentials := c.Credentials()
+	return credentials.RefreshToken != "" && credentials.AppKey != "" && credentials.SecretKey != ""
+}
+
+// ensureFreshToken access_token 快过期时先刷新
+// 提前刷新只是尽力而为，刷新失败但 token 还没过期时继续用现在的，真正过期后接口返回的错误码会再触发刷新
+// 失败后一段时间内不再提前刷新，授权接口明确拒绝时不再提前刷新
+func (c *Client) ensureFreshToken(ctx context.Context) error {
+	credentials := c.Credentials()
+	if credentials.ExpiresAt.IsZero() || time.Until(credentials.ExpiresAt) > tokenRefreshMargin || !c.canRefresh() {
+		return nil
+	}
+	c.refreshMu.Lock()
+	defer c.refreshMu.Unlock()
+	if c.refreshRejected || (!c.refreshFailedAt.IsZero() && time.Since(c.refreshFailedAt) < tokenRefreshCooldown) {
+		return nil
+	}
+	err := c.refreshTokenLocked(ctx, credentials.AccessToken)
+	if err == nil || ctx.Err() != nil || !time.Now().Before(credentials.ExpiresAt) {
+		return err
+	}
+	c.refreshFailedAt = time.Now()
+	var oauthErr *OAuthError
+	c.refreshRejected = errors.As(err, &oauthErr)
+	log.Printf("提前刷新 access_token 失败，继续使用当前的: %v\n", err)
+	return nil
+}
+
+// RefreshToken 立即用 refresh_token 换取新的 access_token 并保存
+func (c *Client) RefreshToken(ctx context.Context) error {
+	return c.refreshToken(ctx, c.Token())
+}
+
+// refreshToken 刷新 staleToken，多个协程同时发现过期时只刷新一次，
+// 百度的 refresh_token 只能用一次，后到的协程发现 token 已经换过就直接使用新的
+func (c *Client) refreshToken(ctx context.Context, staleToken string) error {
+	c.refreshMu.Lock()
+	defer c.refreshMu.Unlock()
+	return c.refreshTokenLocked(ctx, staleToken)
+}
+
+// refreshTokenLocked 刷新 staleToken，调用前需要持有 refreshMu
+func (c *Client) refreshTokenLocked(ctx context.Context, staleToken string) error {
+	if c.Token() != staleToken {
+		return nil
+	}
+	old := c.Credentials()
+	credentials, err := c.RequestRefreshToken(ctx, old.AppKey, old.SecretKey, old.RefreshToken)
+	if err != nil {
+		return err
+	}
+	c.tokenMu.Lock()
+	c.AccessToken = credentials.AccessToken
+	c.credentials = credentials
+	c.tokenMu.Unlock()
+	c.refreshFailedAt, c.refreshRejected = time.Time{}, false
+	if c.credentialStore != nil {
+		if err = c.credentialStore.Save(credentials); err != nil {
+			// 旧的 refresh_token 已经失效，保存失败下次启动就需要重新登录
+			log.Printf("保存刷新后的凭证失败，下次需要重新登录: %v\n", err)
+		}
+	}
+	return nil
+}
+
+// withCurrentToken URL 中带 access_token 时换成当前的，刷新 token 后重试的请求自动用上新的
+func (c *Client) withCurrentToken(ctx context.Context, rawURL string) (string, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "", err
+	}
+	query := u.Query()
+	if !query.Has("access_token") {
+		return rawURL, nil
+	}
+	if err = c.ensureFreshToken(ctx); err != nil {
+		return "", err
+	}
+	query.Set("access_token", c.Token())
+	u.RawQuery = query.Encode()
+	return u.String(), nil
+}
@@ -0,0 +1,172 @@
+package baidu_api_test
+
+import (
+	"baidu_tool/baidu_api"
+	"baidu_tool/baidu_api/fakepan"
+	"context"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+)
+
+// memoryStore 保存在内存里的凭证
+type memoryStore struct {
+	mu    sync.Mutex
+	saved []baidu_api.Credentials
+}
+
+func (s *memoryStore) Load() (*baidu_api.Credentials, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.saved) == 0 {
+		return nil, nil
+	}
+	credentials := s.saved[len(s.saved)-1]
+	return &credentials, nil
+}
+
+func (s *memoryStore) Save(credentials *baidu_api.Credentials) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.saved = append(s.saved, *credentials)
+	return nil
+}
+
+func newRefreshingClient(t *testing.T, expiresAt time.Time) (*fakepan.Server, *baidu_api.Client, *memoryStore) {
+	t.Helper()
+	server := fakepan.NewServer(testToken)
+	t.Cleanup(server.Close)
+	store := &memoryStore{}
+	client := baidu_api.NewClient("",
+		baidu_api.WithPanBaseURL(server.URL),
+		baidu_api.WithPCSBaseURL(server.URL),
+		baidu_api.WithOAuthBaseURL(server.URL),
+		baidu_api.WithLimiters(nil),
+		baidu_api.WithCredentials(&baidu_api.Credentials{
+			AppKey:       "ak",
+			SecretKey:    "sk",
+			AccessToken:  testToken,
+			RefreshToken: server.RefreshToken(),
+			ExpiresAt:    expiresAt,
+		}, store),
+	)
+	return server, client, store
+}
+
+func TestRefreshOnExpiredToken(t *testing.T) {
+	server, client, store := newRefreshingClient(t, time.Now().Add(30*24*time.Hour))
+	server.PutFile("/apps/a.txt", []byte("a"))
+	server.ExpireToken()
+
+	// 同时发现过期的请求只刷新一次
+	var wg sync.WaitGroup
+	errs := make(chan error, 8)
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := client.GetDirByList(context.Background(), "/apps")
+			errs <- err
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Fatalf("list after refresh: %v", err)
+		}
+	}
+	if n := server.Requests("refresh_token"); n != 1 {
+		t.Fatalf("refreshed %d times, want 1", n)
+	}
+	if client.Token() != server.Token {
+		t.Fatalf("client token %q, server token %q", client.Token(), server.Token)
+	}
+	saved, _ := store.Load()
+	if saved == nil || saved.AccessToken != server.Token || saved.RefreshToken != server.RefreshToken() {
+		t.Fatalf("saved credentials %+v", saved)
+	}
+	if time.Until(saved.ExpiresAt) < 29*24*time.Hour {
+		t.Fatalf("saved expiry %v", saved.ExpiresAt)
+	}
+}
+
+func TestRefreshBeforeExpiry(t *testing.T) {
+	server, client, store := newRefreshingClient(t, time.Now().Add(time.Hour))
+
+	if _, err := client.GetDirByList(context.Background(), "/"); err != nil {
+		t.Fatal(err)
+	}
+	if server.Requests("refresh_token") != 1 || len(store.saved) != 1 {
+		t.Fatalf("expected one refresh before the request, got %d refreshes and %d saves", server.Requests("refresh_token"), len(store.saved))
+	}
+	// 刷新后有效期充足，不再刷新
+	if _, err := client.GetDirByList(context.Background(), "/"); err != nil {
+		t.Fatal(err)
+	}
+	if server.Requests("refresh_token") != 1 {
+		t.Fatalf("refreshed again: %d", server.Requests("refresh_token"))
+	}
+}
+
+func TestRefreshFailureKeepsValidToken(t *testing.T) {
+	server, client, store := newRefreshingClient(t, time.Now().Add(time.Hour))
+	client.Retry = baidu_api.RetryPolicy{MaxAttempts: 1}
+	server.Fail("refresh_token", 10, http.StatusInternalServerError, 0)
+
+	// 提前刷新失败，但 token 还有效，请求照常进行
+	if _, err := client.GetDirByList(context.Background(), "/"); err != nil {
+		t.Fatalf("request with still valid token: %v", err)
+	}
+	if client.Token() != testToken || len(store.saved) != 0 {
+		t.Fatalf("token should be kept, got %q and %d saves", client.Token(), len(store.saved))
+	}
+
+	// 之后的请求在一段时间内不再提前刷新
+	for i := 0; i < 5; i++ {
+		if _, err := client.GetDirByList(context.Background(), "/"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n := server.Requests("refresh_token"); n != 1 {
+		t.Fatalf("refresh endpoint hit %d times after a failed refresh, want 1", n)
+	}
+
+	// 已经过期时刷新失败才报错
+	expiredServer, expired, _ := newRefreshingClient(t, time.Now().Add(-time.Minute))
+	expired.Retry = baidu_api.RetryPolicy{MaxAttempts: 1}
+	expiredServer.Fail("refresh_token", 10, http.StatusInternalServerError, 0)
+	if _, err := expired.GetDirByList(context.Background(), "/"); err == nil {
+		t.Fatal("expected refresh error for an expired token")
+	}
+}
+
+func TestRejectedRefreshNotRetried(t *testing.T) {
+	server := fakepan.NewServer(testToken)
+	t.Cleanup(server.Close)
+	client := baidu_api.NewClient("",
+		baidu_api.WithPanBaseURL(server.URL),
+		baidu_api.WithPCSBaseURL(server.URL),
+		baidu_api.WithOAuthBaseURL(server.URL),
+		baidu_api.WithLimiters(nil),
+		baidu_api.WithRetryPolicy(baidu_api.RetryPolicy{MaxAttempts: 3}),
+		baidu_api.WithCredentials(&baidu_api.Credentials{
+			AppKey:       "ak",
+			SecretKey:    "sk",
+			AccessToken:  testToken,
+			RefreshToken: "revoked",
+			ExpiresAt:    time.Now().Add(time.Hour),
+		}, nil),
+	)
+
+	// 授权接口拒绝了 refresh_token，不重试，之后的请求也不再提前刷新
+	for i := 0; i < 5; i++ {
+		if _, err := client.GetDirByList(context.Background(), "/"); err != nil {
+			t.Fatalf("request with still valid token: %v", err)
+		}
+	}
+	if n := server.Requests("refresh_token"); n != 1 {
+		t.Fatalf("refresh endpoint hit %d times for a rejected refresh_token, want 1", n)
+	}
+}
@@ -0,0 +1,80 @@
+package baidu_api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// DefaultDLinkTTL 下载地址缓存的时间，百度的 dlink 大约 8 小时后失效，留出余量
+const DefaultDLinkTTL = 7 * time.Hour
+
+// ErrDLinkExpired 下载地址过期或者被拒绝，换一个新的下载地址再试
+var ErrDLinkExpired = errors.New("download link expired")
+
+// dlinkCache 按 fs_id 缓存的下载地址，零值可以直接使用
+// mu 只保护 links 本身，获取下载地址时只锁住这个文件的 cachedDLink，不影响其他文件
+type dlinkCache struct {
+	mu    sync.Mutex
+	links map[int64]*cachedDLink
+}
+
+// cachedDLink 一个文件的下载地址，同一个文件同时只有一个协程去获取，其他协程等它的结果
+type cachedDLink struct {
+	mu      sync.Mutex
+	dlink   string
+	fetched time.Time
+}
+
+// entry fs_id 对应的缓存项，没有时创建一个空的
+func (cache *dlinkCache) entry(fsID int64) *cachedDLink {
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+	if cache.links == nil {
+		cache.links = map[int64]*cachedDLink{}
+	}
+	link, ok := cache.links[fsID]
+	if !ok {
+		link = &cachedDLink{}
+		cache.links[fsID] = link
+	}
+	return link
+}
+
+// dlink 文件的下载地址，没有缓存或者缓存过期时用 filemetas 重新获取，要用的时候再获取，长时间的下载也不会拿到过期的地址
+func (c *Client) dlink(ctx context.Context, fsID int64) (string, error) {
+	link := c.dlinks.entry(fsID)
+	link.mu.Lock()
+	defer link.mu.Unlock()
+	if link.dlink != "" && time.Since(link.fetched) < c.DLinkTTL {
+		return link.dlink, nil
+	}
+	var downloadResp DownloadLinkResp
+	if err := getJSON(ctx, c, "multimedia/filemetas", c.fileMetasURL([]int64{fsID}, FileMetasOptions{DLink: true}), &downloadResp); err != nil {
+		return "", err
+	}
+	if len(downloadResp.List) == 0 || downloadResp.List[0].DLink == "" {
+		return "", fmt.Errorf("fs_id %d: %w", fsID, ErrPathNotFound)
+	}
+	link.dlink, link.fetched = downloadResp.List[0].DLink, time.Now()
+	return link.dlink, nil
+}
+
+// expireDLink 下载地址被拒绝时丢掉缓存，其他分片已经换成新地址的就不用再丢
+func (c *Client) expireDLink(fsID int64, dlink string) {
+	link := c.dlinks.entry(fsID)
+	link.mu.Lock()
+	defer link.mu.Unlock()
+	if link.dlink == dlink {
+		link.dlink = ""
+	}
+}
+
+// forgetDLink 文件下载完成或者放弃后不再需要它的下载地址，下载很多文件时缓存不会一直增长
+func (c *Client) forgetDLink(fsID int64) {
+	c.dlinks.mu.Lock()
+	defer c.dlinks.mu.Unlock()
+	delete(c.dlinks.links, fsID)
+}
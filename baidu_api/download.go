@@ -2,28 +2,32 @@ package baidu_api
 
 import (
 	"baidu_tool/utils"
-	"encoding/json"
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"errors"
 	"fmt"
 	"github.com/vbauerster/mpb"
 	"github.com/vbauerster/mpb/decor"
 	"io"
-	"math/rand"
 	"net/http"
 	"net/url"
 	"os"
-	"runtime"
+	"path/filepath"
 	"sort"
-	"strconv"
 	"strings"
 	"sync"
-	"time"
 )
 
 type DownloadLinkResp struct {
 	Errmsg    string          `json:"errmsg"`
 	Errno     int32           `json:"errno"`
 	List      []*DownloadInfo `json:"list"`
-	RequestID interface{}     `json:"request_id"`
+	RequestID RequestID       `json:"request_id"`
+}
+
+func (r *DownloadLinkResp) apiError(endpoint string) error {
+	return checkErrno(endpoint, int(r.Errno), r.Errmsg, r.RequestID)
 }
 
 type DownloadInfo struct {
@@ -34,21 +38,57 @@ type DownloadInfo struct {
 	MD5      string `json:"md5"`
 	Path     string `json:"path"`
 	Size     int64  `json:"size"`
+	// BlockList 分块的 md5 列表，百度只对部分文件返回，用来判断 md5 是否可靠
+	BlockList []string `json:"block_list,omitempty"`
+}
+
+// FileFailure 一个下载失败的文件
+type FileFailure struct {
+	// Path 网盘路径
+	Path string
+	// LocalPath 本地路径
+	LocalPath string
+	// Err 失败原因
+	Err error
+}
+
+// DownloadError 有文件下载失败，其他文件照常下载完成后一起返回
+type DownloadError struct {
+	// Failures 失败的文件，按网盘路径排序
+	Failures []*FileFailure
+	// Total 这次要下载的文件数量
+	Total int
 }
 
-type fileIndexPath struct {
-	FilePath string
-	Index    int
+func (e *DownloadError) Error() string {
+	msg := strings.Builder{}
+	fmt.Fprintf(&msg, "%d of %d files failed to download", len(e.Failures), e.Total)
+	for _, failure := range e.Failures {
+		fmt.Fprintf(&msg, "\n  %s: %v", failure.Path, failure.Err)
+	}
+	return msg.String()
+}
+
+// Unwrap 让 errors.Is(err, ErrChecksumMismatch) 这类判断对每个文件的失败原因生效
+func (e *DownloadError) Unwrap() []error {
+	errs := make([]error, 0, len(e.Failures))
+	for _, failure := range e.Failures {
+		errs = append(errs, failure.Err)
+	}
+	return errs
 }
 
+// MB50 默认的下载分片大小，超过的文件按这个大小分成多个 Range 请求同时下载
 const MB50 = 50 * 1024 * 1024
 
 // DownloadFileOrDir 下载文件或者下载文件夹中的文件们
 // @author StarkSim
-// @param accessToken 身份凭证
 // @param sources 文件下载信息
 // @param unusedPath 不需要的文件路径前缀，让下载的文件没有太多不需要的前缀
-func DownloadFileOrDir(accessToken string, sources []*FileOrDir, unusedPath string) error {
+// 每个文件先预分配成 .part 文件，各个分片直接写到自己的位置，全部完成并且 md5 核对通过后改名
+// 分片按重试策略重试后仍然失败时只放弃它所在的文件，其他文件照常下载，最后用 *DownloadError 列出失败的文件和原因
+// ctx 被取消时所有下载协程都会停下，等它们都退出后才返回，记录中校验通过的分片下次继续使用
+func (c *Client) DownloadFileOrDir(ctx context.Context, sources []*FileOrDir, unusedPath string) error {
 	var fsIDList []int64
 	for _, item := range sources {
 		// 下载一个文件
@@ -61,393 +101,283 @@ func DownloadFileOrDir(accessToken string, sources []*FileOrDir, unusedPath stri
 	}
 
 	// 用 fs_id 换取下载地址
-	downloadInfos, err := getDownloadInfo(accessToken, fsIDList)
+	downloadInfos, err := c.getDownloadInfo(ctx, fsIDList)
 	if err != nil {
 		return err
 	}
 
 	// 拿到下载地址后，开始协程下载
 	// 协程下载最高并发，cpu 数量
-	maxConcurrentNum := min(runtime.NumCPU(), 16)
+	maxConcurrentNum := c.MaxConcurrent
 	limitChan := make(chan struct{}, maxConcurrentNum)
-	defer close(limitChan)
-	client := http.Client{}
-	// 整理文件结果的协程要有信号量来知道全都处理好了，主协程才能结束
-	joinSliceWG := &sync.WaitGroup{}
+	// 每个文件有一个协程等它的分片都结束后收尾，主协程要等它们都结束
+	finishWG := &sync.WaitGroup{}
+	// 失败的文件都记下来，最后一起返回
+	downloadErr := &DownloadError{Total: len(downloadInfos)}
+	failuresMu := &sync.Mutex{}
+	recordFailure := func(info *DownloadInfo, localPath string, err error) {
+		failuresMu.Lock()
+		defer failuresMu.Unlock()
+		downloadErr.Failures = append(downloadErr.Failures, &FileFailure{Path: info.Path, LocalPath: localPath, Err: err})
+	}
 
 	// 进度条使用的 wg
 	mpbWG := &sync.WaitGroup{}
-	progressBars := mpb.New(mpb.WithWaitGroup(mpbWG))
+	progressBars := mpb.New(mpb.WithWaitGroup(mpbWG), mpb.WithContext(ctx), mpb.WithOutput(c.output()))
 	for _, downloadInfo := range downloadInfos {
+		if ctx.Err() != nil {
+			break
+		}
 
-		// 如果文件已存在，并且大小正确，那么就跳过
-		finalDownloadFilePath := fmt.Sprintf(".%s", strings.TrimPrefix(downloadInfo.Path, unusedPath))
+		// 如果文件已存在，并且大小正确，核对下载时 md5 也要一致，那么就跳过
+		finalDownloadFilePath := c.LocalPath(downloadInfo.Path, unusedPath)
+		baseEvent := TransferEvent{
+			Op:        OpDownload,
+			Path:      downloadInfo.Path,
+			LocalPath: finalDownloadFilePath,
+			Size:      downloadInfo.Size,
+		}
 		finalFileInfo, err := os.Stat(finalDownloadFilePath)
-		if os.IsNotExist(err) {
-			// 不存在，不作为
-		} else {
-			// 存在
+		if err == nil {
 			if finalFileInfo.Size() == downloadInfo.Size {
-				// 文件大小 ok，跳过
-				continue
-			} else {
-				// 文件不对，删除重新下
-				if err = os.Remove(finalDownloadFilePath); err != nil {
-					fmt.Printf("删除还没完全的文件错误: %v\n", err)
-					return err
+				// 之前下载好的文件也核对 md5，被改过或者损坏的删除重新下载
+				status := VerifySizeOnly
+				if c.VerifyDownloads {
+					if status, err = VerifyLocalFile(finalDownloadFilePath, downloadInfo.Size, downloadInfo.MD5, downloadInfo.BlockList); err != nil {
+						fmt.Fprintf(c.output(), "校验已有文件错误 %s: %v\n", finalDownloadFilePath, err)
+						c.emitFailed(baseEvent, err)
+						recordFailure(downloadInfo, finalDownloadFilePath, err)
+						continue
+					}
+				}
+				if status != VerifyMismatch {
+					// 文件 ok，跳过
+					event := baseEvent
+					event.Type, event.Transferred = EventCompleted, downloadInfo.Size
+					c.emit(event)
+					continue
 				}
 			}
+			// 文件不对，删除重新下
+			if err = os.Remove(finalDownloadFilePath); err != nil {
+				fmt.Fprintf(c.output(), "删除还没完全的文件错误: %v\n", err)
+				c.emitFailed(baseEvent, err)
+				recordFailure(downloadInfo, finalDownloadFilePath, err)
+				continue
+			}
 		}
 
-		// 如果文件太大，就下切片
-		var lastSize int64
-		var sliceNum int64
-		if downloadInfo.Size > MB50 {
-			// 多少个 50 MB
-			sliceNum = downloadInfo.Size / MB50
-			// 下载完最后的碎片多大
-			lastSize = downloadInfo.Size % MB50
-		} else {
-			lastSize = downloadInfo.Size
+		// 打开或继续上次的 .part 文件
+		fileDownload, err := c.openFileDownload(downloadInfo, finalDownloadFilePath)
+		if err != nil {
+			fmt.Fprintf(c.output(), "准备下载文件错误 %s: %v\n", finalDownloadFilePath, err)
+			c.emitFailed(baseEvent, err)
+			recordFailure(downloadInfo, finalDownloadFilePath, err)
+			continue
+		}
+		fileEvent := func(eventType string) TransferEvent {
+			event := baseEvent
+			event.Type = eventType
+			event.Transferred = fileDownload.transferred.Load()
+			return event
 		}
 
 		// 每当要下载一个完整的文件，就加一条进度条
-		mpbWG.Add(1)
-		tempBar := progressBars.AddBar(
-			downloadInfo.Size,
-			mpb.PrependDecorators(
-				decor.Name(downloadInfo.Filename),
-				decor.Percentage(decor.WCSyncSpace),
-			),
-			mpb.AppendDecorators(
-				decor.OnComplete(
-					decor.EwmaETA(decor.ET_STYLE_GO, 30, decor.WCSyncWidth),
-					"done",
+		// 空文件没有分片，不加进度条，mpb 里大小为 0 的进度条永远不会结束
+		var bar *mpb.Bar
+		if downloadInfo.Size > 0 {
+			mpbWG.Add(1)
+			bar = progressBars.AddBar(
+				downloadInfo.Size,
+				mpb.PrependDecorators(
+					decor.Name(downloadInfo.Filename),
+					decor.Percentage(decor.WCSyncSpace),
 				),
-			),
-			mpb.BarRemoveOnComplete(),
-		)
-
-		// 准备下载请求
-		_url := downloadInfo.DLink + "&access_token=" + accessToken
-		realUrl, err := url.Parse(_url)
-		if err != nil {
-			return err
+				mpb.AppendDecorators(
+					decor.OnComplete(
+						decor.EwmaETA(decor.ET_STYLE_GO, 30, decor.WCSyncWidth),
+						"done",
+					),
+				),
+				mpb.BarRemoveOnComplete(),
+			)
+			// 上次已经完成的分片直接算进进度
+			bar.IncrBy(int(fileDownload.transferred.Load()))
+		}
+		// 进度条可能已经因为满了或者 ctx 取消被 mpb 结束，Abort 时要从列表里移除，不然会被结束两次
+		abortBar := func() {
+			if bar != nil {
+				progressBars.Abort(bar, true)
+			}
 		}
-		if sliceNum > 0 {
-			// 请先看非协程部分代码，只有 limitChan 会起到代码阻塞作用，其他的下载，结果拼接过程都是在协程中进行的。
-			// 目的是为了充分发挥网络并发能力，可以让多个文件同时以切片形式下载
+		c.emit(fileEvent(EventStarted))
 
-			// 每一个分片下载的文件都有一个信道作为最后收集碎片文件信息的媒介
-			tempFileChan := make(chan *fileIndexPath, 5)
-			// 有一个独立协程做收集文件信息并最后拼接操作
-			joinSliceWG.Add(1)
-			go func(innerFileChan chan *fileIndexPath, finalFileName string, barWG *sync.WaitGroup) {
-				var sliceFileIndexPaths []*fileIndexPath
-				for tempFileIndexPath := range innerFileChan {
-					sliceFileIndexPaths = append(sliceFileIndexPaths, tempFileIndexPath)
+		// 分片下载，只有 limitChan 会阻塞，多个文件的分片可以同时下载
+		rangeWG := &sync.WaitGroup{}
+		for i := 0; i < fileDownload.rangeCount(); i++ {
+			if fileDownload.isCompleted(i) {
+				continue
+			}
+			if err = acquire(ctx, limitChan); err != nil {
+				break
+			}
+			// 这个文件已经有分片失败了，剩下的分片不用再下载
+			if fileDownload.failure() != nil {
+				<-limitChan
+				break
+			}
+			rangeWG.Add(1)
+			go func(rangeIndex int) {
+				defer rangeWG.Done()
+				offset, length := fileDownload.rangeBounds(rangeIndex)
+				checksum, err := c.downloadRange(ctx, fileDownload.info.FsID, offset, length, fileDownload.file)
+				// 网络请求结束后要收回下载并发信号量
+				<-limitChan
+				if err == nil {
+					err = fileDownload.markCompleted(rangeIndex, checksum)
 				}
-				targetFile, err := os.OpenFile("."+strings.TrimPrefix(finalFileName, unusedPath), os.O_APPEND|os.O_WRONLY|os.O_CREATE, 0777)
-				defer targetFile.Close()
 				if err != nil {
-					fmt.Printf("打开目标文件错误: %v\n", err)
-					return
-				}
-				// 按升序排序
-				sort.Slice(sliceFileIndexPaths, func(i, j int) bool {
-					return sliceFileIndexPaths[i].Index < sliceFileIndexPaths[j].Index
-				})
-
-				// 拼接后要删除文件，都删除完拼接过程再算结束
-				removeSliceWG := &sync.WaitGroup{}
-				for i := 0; i < len(sliceFileIndexPaths); i++ {
-					content, err := os.ReadFile(sliceFileIndexPaths[i].FilePath)
-					if err != nil {
-						fmt.Printf("读碎片文件错误")
-						return
-					}
-					_, err = targetFile.Write(content)
-					if err != nil {
-						fmt.Printf("追加文件错误")
-						return
+					// 一个文件只报告第一个失败的分片
+					if ctx.Err() == nil && fileDownload.fail(err) {
+						fmt.Fprintf(c.output(), "下载分片失败 %s [%d]: %v\n", finalDownloadFilePath, rangeIndex, err)
+						c.emitFailed(fileEvent(EventFailed), err)
 					}
-					removeSliceWG.Add(1)
-					go func(sliceFile string, wg *sync.WaitGroup) {
-						if err = os.Remove(sliceFile); err != nil {
-							fmt.Printf("删除碎片文件错误")
-							return
-						}
-						wg.Done()
-					}(sliceFileIndexPaths[i].FilePath, removeSliceWG)
+					return
 				}
+				// 进度条增长
+				bar.IncrBy(int(length))
+				fileDownload.transferred.Add(length)
+				c.emit(fileEvent(EventProgress))
+			}(i)
+		}
 
-				fmt.Printf("文件拼接好了 %s\n", "."+strings.TrimPrefix(finalFileName, unusedPath))
-				// 进度条展示完成
-				barWG.Done()
-
-				// 等待删除结束
-				removeSliceWG.Wait()
-
-				// 文件拼接完成，意味着单元程序可以结束
-				joinSliceWG.Done()
-
-			}(tempFileChan, downloadInfo.Path, mpbWG)
-
-			// 分片下载需要一个信号量让接受文件结果协程知道收集可以结束
-			downloadWG := &sync.WaitGroup{}
-			// 分片下载
-			for i := 0; i < int(sliceNum); i++ {
-				downloadWG.Add(1)
-				// 先得到最终的碎片文件路径
-				localDownloadFilePath := fmt.Sprintf(".%s_%d", strings.TrimPrefix(downloadInfo.Path, unusedPath), i)
-				// 如果碎片文件已存在，那么直接算作完成跳过
-				_, err = os.Stat(localDownloadFilePath)
-				if os.IsNotExist(err) {
-					// 不存在，准备启动协程下载
-					// 要启动下载协程时在获取一个下载进程限制器量
-					limitChan <- struct{}{}
-					// 并留点间隔不然百度容易拒绝请求
-					time.Sleep(time.Second + time.Millisecond*time.Duration(rand.Intn(100)))
-					go func(sliceIndex int, innerFileChan chan *fileIndexPath, innerDownloadWG *sync.WaitGroup, _url *url.URL, fileDownloadPath string, bar *mpb.Bar) {
-						header := http.Header{}
-						header.Set("User-Agent", "pan.baidu.com")
-						header.Set("Range", fmt.Sprintf("bytes=%v-%v", sliceIndex*MB50, sliceIndex*MB50+MB50-1))
-						request := http.Request{
-							Method: "GET",
-							URL:    _url,
-							Header: header,
-						}
-						// 重传直到完成
-						for {
-							resp, err := client.Do(&request)
-							if err != nil {
-								fmt.Printf("网络连接错误 clientDo\n")
-								continue
-							}
-							if resp.StatusCode != 206 && resp.StatusCode != 200 {
-								bts, _ := io.ReadAll(resp.Body)
-								fmt.Printf("状态码非 206 %s\n", bts)
-								continue
-							}
-							defer resp.Body.Close()
-							respBytes, err := io.ReadAll(resp.Body)
-							if err != nil {
-								fmt.Printf("返回读取错误 ioReadAll\n")
-								continue
-							}
-							dir, _, err := utils.DivideDirAndFile(fileDownloadPath)
-							if err != nil {
-								continue
-							}
-							if err = os.MkdirAll(dir, 0750); err != nil {
-								fmt.Printf("创建文件夹错误 mkdirAll\n")
-								continue
-							}
-							if err = os.WriteFile(fileDownloadPath, respBytes, 0666); err != nil {
-								fmt.Printf("写文件错误 osWriteFile\n")
-								continue
-							}
-							// 网络请求下载好后要收回下载并发信号量
-							<-limitChan
-							// 保存好文件后，推送自己完成的文件信息
-							innerFileChan <- &fileIndexPath{
-								FilePath: fileDownloadPath,
-								Index:    sliceIndex,
-							}
-							// 进度条增长
-							bar.IncrBy(MB50)
-							// 下载同步量完成一个
-							innerDownloadWG.Done()
-							break
-						}
-					}(i, tempFileChan, downloadWG, realUrl, localDownloadFilePath, tempBar)
-				} else {
-					// 存在，成功跳过
-					// 执行文件成功下载保存后的步骤，推送自己完成的文件信息
-					tempFileChan <- &fileIndexPath{
-						FilePath: localDownloadFilePath,
-						Index:    i,
-					}
-					// 进度条增长
-					tempBar.IncrBy(MB50)
-					downloadWG.Done()
-				}
+		// 这一步也不阻塞，因为还有下一个文件
+		finishWG.Add(1)
+		go func() {
+			defer finishWG.Done()
+			if bar != nil {
+				defer mpbWG.Done()
 			}
-
-			// 下载最后一个文件
-			downloadWG.Add(1)
-			// 先得到最终的碎片文件路径
-			localDownloadFilePath := fmt.Sprintf(".%s_%d", strings.TrimPrefix(downloadInfo.Path, unusedPath), sliceNum)
-			// 如果碎片文件已存在，那么直接算作完成跳过
-			_, err = os.Stat(localDownloadFilePath)
-			if os.IsNotExist(err) {
-				// 不存在，开启协程下载
-				limitChan <- struct{}{}
-				time.Sleep(time.Second + time.Millisecond*time.Duration(rand.Intn(100)))
-				go func(innerFileChan chan *fileIndexPath, innerDownloadWG *sync.WaitGroup, _url *url.URL, fileDownloadPath string, bar *mpb.Bar) {
-					header := http.Header{}
-					header.Set("User-Agent", "pan.baidu.com")
-					header.Set("Range", fmt.Sprintf("bytes=%v-%v", sliceNum*MB50, sliceNum*MB50+lastSize-1))
-					request := http.Request{
-						Method: "GET",
-						URL:    _url,
-						Header: header,
-					}
-					// 重传直到通过
-					for {
-						resp, err := client.Do(&request)
-						if err != nil {
-							fmt.Printf("网络连接错误 clientDo\n")
-							continue
-						}
-						if resp.StatusCode != 206 && resp.StatusCode != 200 {
-							bts, _ := io.ReadAll(resp.Body)
-							fmt.Printf("状态码非 206 %s\n", bts)
-							continue
-						}
-						defer resp.Body.Close()
-						respBytes, err := io.ReadAll(resp.Body)
-						if err != nil {
-							fmt.Printf("返回读取错误 ioReadAll\n")
-							continue
-						}
-						dir, _, err := utils.DivideDirAndFile(fileDownloadPath)
-						if err != nil {
-							continue
-						}
-						if err = os.MkdirAll(dir, 0750); err != nil {
-							fmt.Printf("创建文件夹错误 mkdirAll\n")
-							continue
-						}
-						if err = os.WriteFile(fileDownloadPath, respBytes, 0666); err != nil {
-							fmt.Printf("写文件错误 osWriteFile\n")
-							continue
-						}
-						<-limitChan
-						// 保存好文件后，推送自己完成的文件信息
-						innerFileChan <- &fileIndexPath{
-							FilePath: fileDownloadPath,
-							Index:    int(sliceNum),
-						}
-						// 进度条增长
-						bar.IncrBy(int(lastSize))
-						innerDownloadWG.Done()
-						break
-					}
-				}(tempFileChan, downloadWG, realUrl, localDownloadFilePath, tempBar)
-			} else {
-				// 存在，成功跳过
-				// 保存好文件后，推送自己完成的文件信息
-				tempFileChan <- &fileIndexPath{
-					FilePath: localDownloadFilePath,
-					Index:    int(sliceNum),
+			rangeWG.Wait()
+			// 分片都结束了，不管成功与否都不再需要下载地址
+			c.forgetDLink(fileDownload.info.FsID)
+			// 有分片没下载成功，保留 .part 文件和已完成的记录等下次续传
+			if !fileDownload.allCompleted() {
+				_ = fileDownload.file.Close()
+				abortBar()
+				if err := fileDownload.failure(); err != nil {
+					recordFailure(fileDownload.info, finalDownloadFilePath, err)
 				}
-				// 进度条增长
-				tempBar.IncrBy(int(lastSize))
-				downloadWG.Done()
+				return
 			}
-
-			// 这一步也不阻塞，因为还有下一个文件
-			go func(innerDownloadWG *sync.WaitGroup, innerChan chan *fileIndexPath) {
-				// 都下载并传输结果完毕
-				innerDownloadWG.Wait()
-				// 那么就可以关闭结果传输信道，让结果收集者知道传输完了
-				close(innerChan)
-			}(downloadWG, tempFileChan)
-		} else {
-			// 小文件 不需要分片
-			// 把文件保存为一个文件
-			localDownloadFilePath := "." + strings.TrimPrefix(downloadInfo.Path, unusedPath)
-			// 如果碎片文件已存在，那么直接算作完成跳过
-			_, err = os.Stat(localDownloadFilePath)
-			if os.IsNotExist(err) {
-				// 不存在，协程下载
-				limitChan <- struct{}{}
-				time.Sleep(time.Second + time.Millisecond*time.Duration(rand.Intn(100)))
-				go func(_url *url.URL, fileDownloadPath string, bar *mpb.Bar, barWG *sync.WaitGroup, fileSize int64) {
-					header := http.Header{}
-					header.Set("User-Agent", "pan.baidu.com")
-					request := http.Request{
-						Method: "GET",
-						URL:    _url,
-						Header: header,
-					}
-					for {
-						resp, err := client.Do(&request)
-						if err != nil {
-							fmt.Printf("网络连接错误 clientDo\n")
-							continue
-						}
-						if resp.StatusCode != 206 && resp.StatusCode != 200 {
-							bts, _ := io.ReadAll(resp.Body)
-							fmt.Printf("状态码非 206 %s\n", bts)
-							continue
-						}
-						defer resp.Body.Close()
-						respBytes, err := io.ReadAll(resp.Body)
-						if err != nil {
-							fmt.Printf("返回读取错误 ioReadAll\n")
-							continue
-						}
-						dir, _, err := utils.DivideDirAndFile(fileDownloadPath)
-						if err != nil {
-							continue
-						}
-						if err = os.MkdirAll(dir, 0750); err != nil {
-							fmt.Printf("创建文件夹错误 mkdirAll\n")
-							continue
-						}
-						if err = os.WriteFile(fileDownloadPath, respBytes, 0666); err != nil {
-							fmt.Printf("写文件错误 osWriteFile\n")
-							continue
-						}
-						<-limitChan
-						// 下载完成，进度条增长
-						bar.IncrBy(int(fileSize))
-						barWG.Done()
-						break
-					}
-				}(realUrl, localDownloadFilePath, tempBar, mpbWG, downloadInfo.Size)
-			} else {
-				// 存在，成功跳过
-				tempBar.IncrBy(int(downloadInfo.Size))
-				mpbWG.Done()
+			// md5 核对通过后再改名成最终文件，verify 失败和 finish 都会关闭 .part 文件
+			var err error
+			if c.VerifyDownloads && ReliableMD5(fileDownload.info.MD5, fileDownload.info.Size, fileDownload.info.BlockList) {
+				err = fileDownload.verify()
 			}
-		}
+			if err == nil {
+				err = fileDownload.finish()
+			}
+			if err != nil {
+				fmt.Fprintf(c.output(), "保存文件错误 %s: %v\n", finalDownloadFilePath, err)
+				c.emitFailed(fileEvent(EventFailed), err)
+				recordFailure(fileDownload.info, finalDownloadFilePath, err)
+				abortBar()
+				return
+			}
+			c.emit(fileEvent(EventCompleted))
+		}()
 	}
 	// 等待进度条都结束
 	progressBars.Wait()
 	// 这个 wg 结束了，那就都结束了
-	joinSliceWG.Wait()
-	return nil
+	finishWG.Wait()
+	if len(downloadErr.Failures) == 0 {
+		return ctx.Err()
+	}
+	sort.Slice(downloadErr.Failures, func(i, j int) bool {
+		return downloadErr.Failures[i].Path < downloadErr.Failures[j].Path
+	})
+	if err = ctx.Err(); err != nil {
+		return errors.Join(err, downloadErr)
+	}
+	return downloadErr
+}
+
+// LocalPath 网盘文件下载到本地的路径，去掉不需要的前缀后放在 DownloadDir 下，没有配置时放在当前目录
+func (c *Client) LocalPath(baiduPath string, unusedPath string) string {
+	dir := c.DownloadDir
+	if dir == "" {
+		dir = "."
+	}
+	return filepath.Join(dir, strings.TrimPrefix(baiduPath, unusedPath))
+}
+
+// downloadRange 按重试策略下载 fs_id 文件的 [offset, offset+length) 这一段，直接写到 w 的对应位置，返回这一段内容的 md5
+// 每次尝试前取缓存的下载地址，地址过期被拒绝时丢掉缓存，下一次尝试会重新获取
+func (c *Client) downloadRange(ctx context.Context, fsID int64, offset int64, length int64, w io.WriterAt) (string, error) {
+	var checksum string
+	err := c.Retry.Do(ctx, func() error {
+		dlink, err := c.dlink(ctx, fsID)
+		if err != nil {
+			return err
+		}
+		if err = c.downloadLimiter().Wait(ctx); err != nil {
+			return err
+		}
+		request, err := c.newRequest(ctx, "GET", dlink+"&access_token="+url.QueryEscape(c.Token()), nil)
+		if err != nil {
+			return err
+		}
+		request.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", offset, offset+length-1))
+		resp, err := c.httpClient().Do(request)
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode == http.StatusForbidden {
+			bts, _ := io.ReadAll(resp.Body)
+			c.expireDLink(fsID, dlink)
+			return fmt.Errorf("%w: %w", ErrDLinkExpired, &utils.HTTPStatusError{StatusCode: resp.StatusCode, Body: bts})
+		}
+		// 不支持 Range 时返回 200 和整个文件，只有从头开始的分片可以用
+		if resp.StatusCode != 206 && !(resp.StatusCode == 200 && offset == 0) {
+			bts, _ := io.ReadAll(resp.Body)
+			statusErr := &utils.HTTPStatusError{StatusCode: resp.StatusCode, Body: bts}
+			if isRateLimited(statusErr) {
+				c.downloadLimiter().SlowDown()
+			}
+			return statusErr
+		}
+		// 每次尝试都从这一段的开头重新写，md5 也重新算
+		hash := md5.New()
+		written, err := io.Copy(io.MultiWriter(io.NewOffsetWriter(w, offset), hash), io.LimitReader(resp.Body, length))
+		if err != nil {
+			return err
+		}
+		if written != length {
+			return fmt.Errorf("range %d-%d: got %d bytes: %w", offset, offset+length-1, written, io.ErrUnexpectedEOF)
+		}
+		checksum = hex.EncodeToString(hash.Sum(nil))
+		return nil
+	})
+	return checksum, err
 }
 
-// 一次性拿到要下载的文件的下载地址们
-func getDownloadInfo(accessToken string, fsIDList []int64) ([]*DownloadInfo, error) {
+// 一次性拿到要下载的文件的大小和 md5 们，下载地址会过期，下载每个文件时再获取
+func (c *Client) getDownloadInfo(ctx context.Context, fsIDList []int64) ([]*DownloadInfo, error) {
 	if fsIDList == nil || len(fsIDList) == 0 {
 		return nil, nil
 	}
-	preUrl := "http://pan.baidu.com/rest/2.0/xpan/multimedia?method=filemetas&access_token=%s&fsids=%s&dlink=1"
-	var strFsIDList []string
-	for _, fsID := range fsIDList {
-		strFsIDList = append(strFsIDList, strconv.FormatInt(fsID, 10))
-	}
-	fsids := "[" + strings.Join(strFsIDList, ",") + "]"
-	resp, err := http.Get(fmt.Sprintf(preUrl, accessToken, fsids))
-	if err != nil {
-		return nil, err
-	}
-	defer resp.Body.Close()
-	respBytes, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return nil, err
-	}
-	var downloadResp DownloadLinkResp
-	if err = json.Unmarshal(respBytes, &downloadResp); err != nil {
-		return nil, err
-	}
-	if downloadResp.Errno != 0 {
-		return nil, fmt.Errorf("api no return or return err: %v", downloadResp)
+	var downloadInfos []*DownloadInfo
+	// 一次最多查询 100 个
+	for start := 0; start < len(fsIDList); start += maxFileMetasBatch {
+		batch := fsIDList[start:min(start+maxFileMetasBatch, len(fsIDList))]
+		var downloadResp DownloadLinkResp
+		if err := getJSON(ctx, c, "multimedia/filemetas", c.fileMetasURL(batch, FileMetasOptions{}), &downloadResp); err != nil {
+			return nil, err
+		}
+		downloadInfos = append(downloadInfos, downloadResp.List...)
 	}
-	return downloadResp.List, nil
+	return downloadInfos, nil
 }
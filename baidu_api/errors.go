@@ -0,0 +1,99 @@
+package baidu_api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// 百度接口常见错误，用 errors.Is 判断 APIError 属于哪一种
+var (
+	// ErrPathNotFound 文件或文件夹不存在
+	ErrPathNotFound = errors.New("path not found")
+	// ErrTokenExpired access_token 无效或已过期
+	ErrTokenExpired = errors.New("access token invalid or expired")
+	// ErrRateLimited 请求频率过高被百度限制
+	ErrRateLimited = errors.New("rate limited")
+	// ErrFileExists 文件或文件夹已存在
+	ErrFileExists = errors.New("file already exists")
+	// ErrQuotaExceeded 网盘空间不足
+	ErrQuotaExceeded = errors.New("quota exceeded")
+)
+
+// errnoSentinels 错误码和常见错误的对应，xpan 接口用 errno，pcs 接口用 error_code
+var errnoSentinels = map[int]error{
+	-9:    ErrPathNotFound,
+	31066: ErrPathNotFound,
+	-6:    ErrTokenExpired,
+	110:   ErrTokenExpired,
+	111:   ErrTokenExpired,
+	31034: ErrRateLimited,
+	-8:    ErrFileExists,
+	31061: ErrFileExists,
+	-10:   ErrQuotaExceeded,
+	31112: ErrQuotaExceeded,
+}
+
+// APIError 百度接口返回的错误码
+type APIError struct {
+	// Errno 错误码
+	Errno int
+	// Errmsg 错误信息，有的接口不返回
+	Errmsg string
+	// RequestID 百度的请求 ID，反馈问题时需要
+	RequestID string
+	// Endpoint 出错的接口，如 file/precreate
+	Endpoint string
+}
+
+func (e *APIError) Error() string {
+	msg := fmt.Sprintf("baidu api %s errno %d", e.Endpoint, e.Errno)
+	if e.Errmsg != "" {
+		msg += ": " + e.Errmsg
+	} else if sentinel, ok := errnoSentinels[e.Errno]; ok {
+		msg += ": " + sentinel.Error()
+	}
+	if e.RequestID != "" {
+		msg += " (request_id " + e.RequestID + ")"
+	}
+	return msg
+}
+
+// Is 让 errors.Is(err, ErrPathNotFound) 这类判断按错误码生效
+func (e *APIError) Is(target error) bool {
+	sentinel, ok := errnoSentinels[e.Errno]
+	return ok && sentinel == target
+}
+
+// checkErrno 错误码非 0 时包装成 APIError
+func checkErrno(endpoint string, errno int, errmsg string, requestID RequestID) error {
+	if errno == 0 {
+		return nil
+	}
+	return &APIError{
+		Errno:     errno,
+		Errmsg:    errmsg,
+		RequestID: string(requestID),
+		Endpoint:  endpoint,
+	}
+}
+
+// RequestID 百度的请求 ID，不同接口有时返回数字有时返回字符串，统一成字符串
+type RequestID string
+
+func (r *RequestID) UnmarshalJSON(data []byte) error {
+	if string(data) == "null" {
+		return nil
+	}
+	var s string
+	if err := json.Unmarshal(data, &s); err == nil {
+		*r = RequestID(s)
+		return nil
+	}
+	var n json.Number
+	if err := json.Unmarshal(data, &n); err != nil {
+		return err
+	}
+	*r = RequestID(n.String())
+	return nil
+}
@@ -0,0 +1,67 @@
+package baidu_api_test
+
+import (
+	"baidu_tool/baidu_api"
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+func TestAPIErrorIs(t *testing.T) {
+	cases := []struct {
+		errno    int
+		sentinel error
+	}{
+		{-9, baidu_api.ErrPathNotFound},
+		{-6, baidu_api.ErrTokenExpired},
+		{111, baidu_api.ErrTokenExpired},
+		{31034, baidu_api.ErrRateLimited},
+		{-8, baidu_api.ErrFileExists},
+		{-10, baidu_api.ErrQuotaExceeded},
+	}
+	for _, c := range cases {
+		var err error = &baidu_api.APIError{Errno: c.errno, Endpoint: "file/list"}
+		if !errors.Is(err, c.sentinel) {
+			t.Errorf("errno %d should match %v", c.errno, c.sentinel)
+		}
+		if errors.Is(err, baidu_api.ErrQuotaExceeded) != (c.sentinel == baidu_api.ErrQuotaExceeded) {
+			t.Errorf("errno %d matched an unrelated sentinel", c.errno)
+		}
+	}
+}
+
+func TestRequestIDAcceptsNumberAndString(t *testing.T) {
+	var resp struct {
+		RequestID baidu_api.RequestID `json:"request_id"`
+	}
+	for input, want := range map[string]string{
+		`{"request_id": 8978146537913539581}`: "8978146537913539581",
+		`{"request_id": "1234"}`:              "1234",
+	} {
+		if err := json.Unmarshal([]byte(input), &resp); err != nil {
+			t.Fatal(err)
+		}
+		if string(resp.RequestID) != want {
+			t.Errorf("got %q, want %q", resp.RequestID, want)
+		}
+	}
+}
+
+func TestAPIErrorsFromServer(t *testing.T) {
+	_, client := newTestClient(t)
+
+	_, err := client.GetDirByList(context.Background(), "/apps/missing")
+	if !errors.Is(err, baidu_api.ErrPathNotFound) {
+		t.Fatalf("expected ErrPathNotFound, got %v", err)
+	}
+	var apiErr *baidu_api.APIError
+	if !errors.As(err, &apiErr) || apiErr.Endpoint != "file/list" || apiErr.RequestID == "" {
+		t.Fatalf("expected APIError with endpoint and request_id, got %#v", apiErr)
+	}
+
+	client.AccessToken = "wrong"
+	if _, err = client.GetFileOrDirResp(context.Background(), "/apps", 0); !errors.Is(err, baidu_api.ErrTokenExpired) {
+		t.Fatalf("expected ErrTokenExpired, got %v", err)
+	}
+}
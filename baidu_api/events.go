@@ -0,0 +1,75 @@
+package baidu_api
+
+import (
+	"errors"
+	"time"
+)
+
+// 传输事件的类型
+const (
+	// EventStarted 开始传输一个文件
+	EventStarted = "started"
+	// EventProgress 文件传输完一个分片
+	EventProgress = "progress"
+	// EventCompleted 文件传输完成，包括本地已存在而跳过的
+	EventCompleted = "completed"
+	// EventFailed 文件传输失败
+	EventFailed = "failed"
+)
+
+// 传输的方向
+const (
+	OpUpload   = "upload"
+	OpDownload = "download"
+)
+
+// TransferEvent 上传下载过程中一个文件的事件，可以直接编码成 json
+type TransferEvent struct {
+	// Type 事件类型，EventStarted 等
+	Type string `json:"event"`
+	// Op 上传还是下载
+	Op string `json:"op"`
+	// Path 网盘路径
+	Path string `json:"path"`
+	// LocalPath 本地路径
+	LocalPath string `json:"local_path"`
+	// Size 文件大小
+	Size int64 `json:"size"`
+	// Transferred 已经传输的字节数
+	Transferred int64 `json:"transferred"`
+	// Errno 失败时百度接口的错误码，不是接口错误时为 0
+	Errno int `json:"errno,omitempty"`
+	// Error 失败原因
+	Error string `json:"error,omitempty"`
+	// Time 事件发生的时间
+	Time time.Time `json:"time"`
+}
+
+// WithEventHandler 设置传输事件的处理函数，事件是逐个串行交给 handler 的
+func WithEventHandler(handler func(TransferEvent)) ClientOption {
+	return func(c *Client) {
+		c.OnEvent = handler
+	}
+}
+
+// emit 发出一个事件，没有设置处理函数时什么都不做
+func (c *Client) emit(event TransferEvent) {
+	if c.OnEvent == nil {
+		return
+	}
+	event.Time = time.Now()
+	c.eventMu.Lock()
+	defer c.eventMu.Unlock()
+	c.OnEvent(event)
+}
+
+// emitFailed 发出失败事件，接口错误会带上错误码
+func (c *Client) emitFailed(event TransferEvent, err error) {
+	event.Type = EventFailed
+	event.Error = err.Error()
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		event.Errno = apiErr.Errno
+	}
+	c.emit(event)
+}
@@ -0,0 +1,69 @@
+package fakepan
+
+import (
+	"net/http"
+	"strconv"
+)
+
+// DefaultQuota 假服务默认的网盘总空间，2TB
+const DefaultQuota int64 = 2 << 40
+
+// SetQuota 设置网盘总空间
+func (s *Server) SetQuota(total int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.quota = total
+}
+
+// usedLocked 所有文件的大小之和
+func (s *Server) usedLocked() int64 {
+	var used int64
+	for _, f := range s.files {
+		used += f.Size()
+	}
+	return used
+}
+
+func (s *Server) handleNas(w http.ResponseWriter, r *http.Request) {
+	if !s.checkToken(w, r) {
+		return
+	}
+	method := r.URL.Query().Get("method")
+	if !s.count(w, method) {
+		return
+	}
+	if method != "uinfo" {
+		s.writeErrno(w, ErrnoParam, "unknown method "+method)
+		return
+	}
+	s.writeJSON(w, map[string]any{
+		"errno":        ErrnoOK,
+		"errmsg":       "succ",
+		"baidu_name":   "fake_user",
+		"netdisk_name": "fake_netdisk",
+		"avatar_url":   s.URL + "/avatar.jpg",
+		"vip_type":     2,
+		"uk":           123456789,
+		"request_id":   strconv.FormatInt(s.requestID(), 10),
+	})
+}
+
+func (s *Server) handleQuota(w http.ResponseWriter, r *http.Request) {
+	if !s.checkToken(w, r) {
+		return
+	}
+	if !s.count(w, "quota") {
+		return
+	}
+	s.mu.Lock()
+	total, used := s.quota, s.usedLocked()
+	s.mu.Unlock()
+	s.writeJSON(w, map[string]any{
+		"errno":      ErrnoOK,
+		"total":      total,
+		"used":       used,
+		"free":       max(total-used, 0),
+		"expire":     false,
+		"request_id": s.requestID(),
+	})
+}
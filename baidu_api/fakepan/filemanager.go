@@ -0,0 +1,134 @@
+package fakepan
+
+import (
+	"encoding/json"
+	"net/http"
+	"path"
+	"strings"
+)
+
+// ErrnoBatchFailed 批量操作中有失败的项
+const ErrnoBatchFailed = 12
+
+// fileOperation filemanager 接口 filelist 中的一项
+type fileOperation struct {
+	Path    string `json:"path"`
+	Dest    string `json:"dest"`
+	NewName string `json:"newname"`
+}
+
+func (s *Server) handleFileManager(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		s.writeErrno(w, ErrnoParam, err.Error())
+		return
+	}
+	opera := r.URL.Query().Get("opera")
+	ondup := r.PostForm.Get("ondup")
+	var operations []fileOperation
+	filelist := []byte(r.PostForm.Get("filelist"))
+	if opera == "delete" {
+		var paths []string
+		if err := json.Unmarshal(filelist, &paths); err != nil {
+			s.writeErrno(w, ErrnoParam, "filelist invalid")
+			return
+		}
+		for _, p := range paths {
+			operations = append(operations, fileOperation{Path: p})
+		}
+	} else if err := json.Unmarshal(filelist, &operations); err != nil {
+		s.writeErrno(w, ErrnoParam, "filelist invalid")
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	errno := ErrnoOK
+	info := []map[string]any{}
+	for _, op := range operations {
+		itemErrno := s.fileOperationLocked(opera, op, ondup)
+		if itemErrno != ErrnoOK {
+			errno = ErrnoBatchFailed
+		}
+		info = append(info, map[string]any{"errno": itemErrno, "path": op.Path})
+	}
+	s.writeJSON(w, map[string]any{
+		"errno":      errno,
+		"info":       info,
+		"taskid":     0,
+		"request_id": s.requestID(),
+	})
+}
+
+// fileOperationLocked 执行一项操作，返回这一项的错误码
+func (s *Server) fileOperationLocked(opera string, op fileOperation, ondup string) int {
+	src := path.Clean(op.Path)
+	f, ok := s.files[src]
+	if !ok || src == "/" {
+		return ErrnoNotFound
+	}
+	if opera == "delete" {
+		s.removeLocked(src)
+		return ErrnoOK
+	}
+
+	dest := path.Dir(src)
+	switch opera {
+	case "move", "copy":
+		dest = path.Clean(op.Dest)
+	case "rename":
+	default:
+		return ErrnoParam
+	}
+	if op.NewName == "" || strings.Contains(op.NewName, "/") {
+		return ErrnoParam
+	}
+	target := path.Join(dest, op.NewName)
+	if target == src {
+		return ErrnoOK
+	}
+	if strings.HasPrefix(target, src+"/") {
+		// 不能移动到自己里面
+		return ErrnoParam
+	}
+	if _, exists := s.files[target]; exists {
+		switch ondup {
+		case "overwrite":
+			s.removeLocked(target)
+		case "newcopy":
+			target = s.renameLocked(target)
+		case "skip":
+			return ErrnoOK
+		default:
+			return ErrnoFileExists
+		}
+	}
+
+	// 文件夹连同里面的内容一起处理
+	entries := append([]*File{f}, s.descendantsLocked(src)...)
+	if opera == "copy" {
+		for _, e := range entries {
+			p := target + strings.TrimPrefix(e.Path, src)
+			if e.IsDir {
+				s.mkdirLocked(p)
+			} else {
+				s.putFileLocked(p, e.Data)
+			}
+		}
+		return ErrnoOK
+	}
+	s.mkdirLocked(dest)
+	for _, e := range entries {
+		delete(s.files, e.Path)
+		e.Path = target + strings.TrimPrefix(e.Path, src)
+		s.files[e.Path] = e
+	}
+	return ErrnoOK
+}
+
+// removeLocked 删除文件或文件夹及其中的内容
+func (s *Server) removeLocked(p string) {
+	for _, e := range s.descendantsLocked(p) {
+		delete(s.files, e.Path)
+	}
+	delete(s.files, p)
+}
@@ -0,0 +1,135 @@
+package fakepan
+
+import (
+	"fmt"
+	"net/http"
+)
+
+// DeviceInterval 设备码授权返回的轮询间隔，单位秒
+const DeviceInterval = 1
+
+// device 一次设备码授权
+type device struct {
+	userCode string
+	approved bool
+}
+
+// ApproveDevice 模拟用户在浏览器里输入 userCode 并同意授权，找不到时返回 false
+func (s *Server) ApproveDevice(userCode string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, d := range s.devices {
+		if d.userCode == userCode {
+			d.approved = true
+			return true
+		}
+	}
+	return false
+}
+
+// writeOAuthError 授权接口的错误格式，http 状态码为 400
+func (s *Server) writeOAuthError(w http.ResponseWriter, code string, description string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusBadRequest)
+	s.writeJSON(w, map[string]any{
+		"error":             code,
+		"error_description": description,
+	})
+}
+
+func (s *Server) handleDeviceCode(w http.ResponseWriter, r *http.Request) {
+	if !s.count(w, "device_code") {
+		return
+	}
+	if r.URL.Query().Get("client_id") == "" {
+		s.writeOAuthError(w, "invalid_client", "unknown client id")
+		return
+	}
+	s.mu.Lock()
+	s.nextID++
+	deviceCode := fmt.Sprintf("device-%d", s.nextID)
+	userCode := fmt.Sprintf("U%d", s.nextID)
+	s.devices[deviceCode] = &device{userCode: userCode}
+	s.mu.Unlock()
+	s.writeJSON(w, map[string]any{
+		"device_code":      deviceCode,
+		"user_code":        userCode,
+		"verification_url": "https://openapi.baidu.com/device",
+		"qrcode_url":       "https://openapi.baidu.com/device/qrcode/" + userCode,
+		"expires_in":       300,
+		"interval":         DeviceInterval,
+	})
+}
+
+func (s *Server) handleToken(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	grantType := query.Get("grant_type")
+	if !s.count(w, grantType) {
+		return
+	}
+	if query.Get("client_id") == "" || query.Get("client_secret") == "" {
+		s.writeOAuthError(w, "invalid_client", "unknown client id")
+		return
+	}
+	switch grantType {
+	case "device_token":
+		s.mu.Lock()
+		d, ok := s.devices[query.Get("code")]
+		approved := ok && d.approved
+		if approved {
+			delete(s.devices, query.Get("code"))
+		}
+		s.mu.Unlock()
+		if !ok {
+			s.writeOAuthError(w, "expired_token", "invalid device code")
+			return
+		}
+		if !approved {
+			s.writeOAuthError(w, "authorization_pending", "User has not yet completed the authorization")
+			return
+		}
+		s.issueToken(w)
+	case "refresh_token":
+		s.mu.Lock()
+		valid := query.Get("refresh_token") == s.refreshToken
+		s.mu.Unlock()
+		if !valid {
+			s.writeOAuthError(w, "invalid_grant", "refresh token has been used")
+			return
+		}
+		s.issueToken(w)
+	default:
+		s.writeOAuthError(w, "unsupported_grant_type", "unsupported grant type "+grantType)
+	}
+}
+
+// RefreshToken 当前有效的 refresh_token
+func (s *Server) RefreshToken() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.refreshToken
+}
+
+// ExpireToken 让当前的 access_token 过期，之后的接口请求返回 111 错误码，直到刷新
+func (s *Server) ExpireToken() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.tokenExpired = true
+}
+
+// issueToken 签发新的 access_token 和 refresh_token，旧的随即失效
+func (s *Server) issueToken(w http.ResponseWriter) {
+	s.mu.Lock()
+	s.nextID++
+	s.Token = fmt.Sprintf("access-%d", s.nextID)
+	s.refreshToken = "refresh-" + s.Token
+	s.tokenExpired = false
+	token, refreshToken := s.Token, s.refreshToken
+	s.mu.Unlock()
+	s.writeJSON(w, map[string]any{
+		"access_token":  token,
+		"refresh_token": refreshToken,
+		"expires_in":    2592000,
+		"scope":         "basic netdisk",
+	})
+}
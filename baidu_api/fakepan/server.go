@@ -0,0 +1,866 @@
+// Package fakepan 进程内的百度网盘假服务，基于 httptest，数据全在内存中，
+// 实现了 xpan 文件列表、递归列表、预上传、创建文件和文件夹、文件管理，filemetas 下载地址，superfile2 分片上传和带 Range 的下载，
+// 以及 OAuth 设备码授权，
+// 用来离线跑通整个上传下载流程
+package fakepan
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 和百度接口保持一致的错误码
+const (
+	ErrnoOK           = 0
+	ErrnoTokenInvalid = -6
+	ErrnoTokenExpired = 111
+	ErrnoFileExists   = -8
+	ErrnoNotFound     = -9
+	ErrnoParam        = 2
+	ErrnoNoUploadID   = 31363
+)
+
+// File 假服务里的一个文件或文件夹
+type File struct {
+	FsID        int64
+	Path        string
+	IsDir       bool
+	Data        []byte
+	MD5         string
+	ServerCtime int64
+	ServerMtime int64
+	// BlockList 分片上传时每片的 md5，直接放进来的文件为 nil
+	BlockList []string
+}
+
+// Name 文件名
+func (f *File) Name() string {
+	return path.Base(f.Path)
+}
+
+// Size 文件大小，文件夹为 0
+func (f *File) Size() int64 {
+	return int64(len(f.Data))
+}
+
+// uploadSession 预上传后到创建文件前的上传过程
+type uploadSession struct {
+	path      string
+	size      int64
+	blockList []string
+	parts     map[int][]byte
+}
+
+// Server 假的百度网盘服务
+type Server struct {
+	*httptest.Server
+	// Token 接口要求的 access_token，为空时不校验，授权签发新 token 后会被替换
+	Token string
+
+	mu       sync.Mutex
+	files    map[string]*File
+	uploads  map[string]*uploadSession
+	nextID   int64
+	requests map[string]int
+	failures map[string][]failure
+	devices  map[string]*device
+	// refreshToken 当前有效的 refresh_token，用过一次就换新的
+	refreshToken string
+	// tokenExpired 为 true 时当前 Token 返回过期错误码
+	tokenExpired bool
+	// quota 网盘总空间
+	quota int64
+	// listPageCap 不为 0 时 list 每页最多返回这么多个，不管请求的 limit
+	listPageCap int
+	// dlinkGeneration 下载地址的版本，过期后之前发出的下载地址都会返回 403
+	dlinkGeneration int
+	// expireDLinksAfter 大于 0 时，再成功下载这么多次后下载地址过期
+	expireDLinksAfter int
+}
+
+// failure 注入的一次失败
+type failure struct {
+	status int
+	errno  int
+}
+
+// NewServer 启动假服务，使用完需要 Close
+func NewServer(token string) *Server {
+	s := &Server{
+		Token:        token,
+		refreshToken: "refresh-" + token,
+		files:        map[string]*File{},
+		uploads:      map[string]*uploadSession{},
+		nextID:       100000,
+		requests:     map[string]int{},
+		failures:     map[string][]failure{},
+		devices:      map[string]*device{},
+		quota:        DefaultQuota,
+	}
+	s.files["/"] = &File{Path: "/", IsDir: true}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/rest/2.0/xpan/file", s.handleFile)
+	mux.HandleFunc("/rest/2.0/xpan/multimedia", s.handleMultimedia)
+	mux.HandleFunc("/rest/2.0/xpan/nas", s.handleNas)
+	mux.HandleFunc("/api/quota", s.handleQuota)
+	mux.HandleFunc("/rest/2.0/pcs/superfile2", s.handleSuperfile2)
+	mux.HandleFunc("/file", s.handleDownload)
+	mux.HandleFunc("/oauth/2.0/device/code", s.handleDeviceCode)
+	mux.HandleFunc("/oauth/2.0/token", s.handleToken)
+	s.Server = httptest.NewServer(mux)
+	return s
+}
+
+// PutFile 直接往假服务里放一个文件，父文件夹会自动创建
+func (s *Server) PutFile(filePath string, data []byte) *File {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.putFileLocked(filePath, data)
+}
+
+// SetMD5 替换文件记录的 md5，模拟网盘的 md5 和内容对不上
+func (s *Server) SetMD5(filePath string, md5 string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if f, ok := s.files[path.Clean(filePath)]; ok {
+		f.MD5 = md5
+	}
+}
+
+// ExpireDLinks 再成功下载 after 次后让已经发出的下载地址都失效，为 0 时立即失效，模拟 dlink 过期
+// 被拒绝的过期地址记在 Requests("dlink_expired") 里
+func (s *Server) ExpireDLinks(after int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if after <= 0 {
+		s.dlinkGeneration++
+		return
+	}
+	s.expireDLinksAfter = after
+}
+
+// Mkdir 创建文件夹，父文件夹会自动创建
+func (s *Server) Mkdir(dirPath string) *File {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.mkdirLocked(dirPath)
+}
+
+// Stat 查看路径对应的文件或文件夹
+func (s *Server) Stat(filePath string) (*File, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	f, ok := s.files[path.Clean(filePath)]
+	return f, ok
+}
+
+// ReadFile 读出文件内容
+func (s *Server) ReadFile(filePath string) ([]byte, bool) {
+	f, ok := s.Stat(filePath)
+	if !ok || f.IsDir {
+		return nil, false
+	}
+	return f.Data, true
+}
+
+// Requests 某个接口被调用的次数，key 为 method，如 precreate、upload、download
+func (s *Server) Requests(method string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.requests[method]
+}
+
+// SetListPageCap 让 list 每页最多返回 n 个，比请求的少，为 0 时按请求的 limit
+func (s *Server) SetListPageCap(n int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.listPageCap = n
+}
+
+// Fail 让接下来 times 次 method 请求失败，status 不为 0 时返回该 http 状态码，否则返回错误码 errno
+func (s *Server) Fail(method string, times int, status int, errno int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i := 0; i < times; i++ {
+		s.failures[method] = append(s.failures[method], failure{status: status, errno: errno})
+	}
+}
+
+// count 记录一次调用，如果有注入的失败就写回失败并返回 false
+func (s *Server) count(w http.ResponseWriter, method string) bool {
+	s.mu.Lock()
+	s.requests[method]++
+	var f *failure
+	if pending := s.failures[method]; len(pending) > 0 {
+		f = &pending[0]
+		s.failures[method] = pending[1:]
+	}
+	s.mu.Unlock()
+	if f == nil {
+		return true
+	}
+	if f.status != 0 {
+		http.Error(w, http.StatusText(f.status), f.status)
+	} else if method == "upload" {
+		s.writePCSError(w, f.errno, "injected failure")
+	} else {
+		s.writeErrno(w, f.errno, "injected failure")
+	}
+	return false
+}
+
+func (s *Server) putFileLocked(filePath string, data []byte) *File {
+	filePath = path.Clean(filePath)
+	s.mkdirLocked(path.Dir(filePath))
+	now := time.Now().Unix()
+	f, ok := s.files[filePath]
+	if !ok {
+		s.nextID++
+		f = &File{FsID: s.nextID, Path: filePath, ServerCtime: now}
+		s.files[filePath] = f
+	}
+	f.Data = data
+	f.MD5 = fmt.Sprintf("%x", md5.Sum(data))
+	f.BlockList = nil
+	f.ServerMtime = now
+	return f
+}
+
+func (s *Server) mkdirLocked(dirPath string) *File {
+	dirPath = path.Clean(dirPath)
+	if f, ok := s.files[dirPath]; ok {
+		return f
+	}
+	s.mkdirLocked(path.Dir(dirPath))
+	now := time.Now().Unix()
+	s.nextID++
+	f := &File{FsID: s.nextID, Path: dirPath, IsDir: true, ServerCtime: now, ServerMtime: now}
+	s.files[dirPath] = f
+	return f
+}
+
+// childrenLocked 文件夹的直接下级，按路径排序
+func (s *Server) childrenLocked(dirPath string) []*File {
+	var children []*File
+	for p, f := range s.files {
+		if p != "/" && path.Dir(p) == dirPath {
+			children = append(children, f)
+		}
+	}
+	sort.Slice(children, func(i, j int) bool {
+		return children[i].Path < children[j].Path
+	})
+	return children
+}
+
+// descendantsLocked 文件夹下所有层级的下级，按路径排序
+func (s *Server) descendantsLocked(dirPath string) []*File {
+	prefix := strings.TrimSuffix(dirPath, "/") + "/"
+	var res []*File
+	for p, f := range s.files {
+		if p != dirPath && strings.HasPrefix(p, prefix) {
+			res = append(res, f)
+		}
+	}
+	sort.Slice(res, func(i, j int) bool {
+		return res[i].Path < res[j].Path
+	})
+	return res
+}
+
+func (s *Server) findByFsIDLocked(fsID int64) (*File, bool) {
+	for _, f := range s.files {
+		if f.FsID == fsID {
+			return f, true
+		}
+	}
+	return nil, false
+}
+
+// fileRecord 列表接口中的一项
+func fileRecord(f *File) map[string]any {
+	isDir := 0
+	if f.IsDir {
+		isDir = 1
+	}
+	return map[string]any{
+		"fs_id":           f.FsID,
+		"path":            f.Path,
+		"server_filename": f.Name(),
+		"size":            f.Size(),
+		"isdir":           isDir,
+		"md5":             f.MD5,
+		"category":        category(f),
+		"server_ctime":    f.ServerCtime,
+		"server_mtime":    f.ServerMtime,
+		"local_ctime":     f.ServerCtime,
+		"local_mtime":     f.ServerMtime,
+	}
+}
+
+// category 按扩展名给出百度的文件类型，1 视频 2 音频 3 图片 4 文档 5 应用 6 其他 7 种子
+func category(f *File) int {
+	if f.IsDir {
+		return 6
+	}
+	switch strings.ToLower(path.Ext(f.Path)) {
+	case ".mp4", ".mkv", ".avi", ".mov":
+		return 1
+	case ".mp3", ".flac", ".wav":
+		return 2
+	case ".jpg", ".jpeg", ".png", ".gif":
+		return 3
+	case ".txt", ".pdf", ".doc", ".docx", ".md":
+		return 4
+	case ".exe", ".apk", ".dmg":
+		return 5
+	case ".torrent":
+		return 7
+	}
+	return 6
+}
+
+func (s *Server) writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func (s *Server) writeErrno(w http.ResponseWriter, errno int, errmsg string) {
+	s.writeJSON(w, map[string]any{
+		"errno":      errno,
+		"errmsg":     errmsg,
+		"request_id": s.requestID(),
+	})
+}
+
+// writePCSError pcs 接口的错误格式和 xpan 不同
+func (s *Server) writePCSError(w http.ResponseWriter, errorCode int, errorMsg string) {
+	s.writeJSON(w, map[string]any{
+		"error_code": errorCode,
+		"error_msg":  errorMsg,
+		"request_id": s.requestID(),
+	})
+}
+
+func (s *Server) requestID() int64 {
+	return time.Now().UnixNano()
+}
+
+// checkToken 校验 access_token，不通过时直接写回错误
+func (s *Server) checkToken(w http.ResponseWriter, r *http.Request) bool {
+	s.mu.Lock()
+	token, expired := s.Token, s.tokenExpired
+	s.mu.Unlock()
+	if token == "" {
+		return true
+	}
+	if r.URL.Query().Get("access_token") == token {
+		if !expired {
+			return true
+		}
+		s.writeErrno(w, ErrnoTokenExpired, "access token expired")
+		return false
+	}
+	s.writeErrno(w, ErrnoTokenInvalid, "access token invalid")
+	return false
+}
+
+func (s *Server) handleFile(w http.ResponseWriter, r *http.Request) {
+	if !s.checkToken(w, r) {
+		return
+	}
+	method := r.URL.Query().Get("method")
+	if !s.count(w, method) {
+		return
+	}
+	switch method {
+	case "list":
+		s.handleList(w, r)
+	case "precreate":
+		s.handlePreCreate(w, r)
+	case "create":
+		s.handleCreate(w, r)
+	case "filemanager":
+		s.handleFileManager(w, r)
+	case "search":
+		s.handleSearch(w, r)
+	default:
+		s.writeErrno(w, ErrnoParam, "unknown method "+method)
+	}
+}
+
+func (s *Server) handleMultimedia(w http.ResponseWriter, r *http.Request) {
+	if !s.checkToken(w, r) {
+		return
+	}
+	method := r.URL.Query().Get("method")
+	if !s.count(w, method) {
+		return
+	}
+	switch method {
+	case "listall":
+		s.handleListAll(w, r)
+	case "filemetas":
+		s.handleFileMetas(w, r)
+	default:
+		s.writeErrno(w, ErrnoParam, "unknown method "+method)
+	}
+}
+
+// intParam 读取整数参数，没有时返回默认值
+func intParam(r *http.Request, key string, def int) int {
+	v := r.URL.Query().Get(key)
+	if v == "" {
+		return def
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		return def
+	}
+	return n
+}
+
+func (s *Server) handleList(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	dir := path.Clean(query.Get("dir"))
+	if query.Get("dir") == "" {
+		dir = "/"
+	}
+	start := intParam(r, "start", 0)
+	limit := intParam(r, "limit", 1000)
+	desc := query.Get("desc") == "1"
+	order := query.Get("order")
+
+	s.mu.Lock()
+	if s.listPageCap > 0 {
+		limit = min(limit, s.listPageCap)
+	}
+	d, ok := s.files[dir]
+	if !ok || !d.IsDir {
+		s.mu.Unlock()
+		s.writeErrno(w, ErrnoNotFound, "not found")
+		return
+	}
+	children := s.childrenLocked(dir)
+	s.mu.Unlock()
+
+	sort.SliceStable(children, func(i, j int) bool {
+		a, b := children[i], children[j]
+		// 百度的 list 总是文件夹在前
+		if a.IsDir != b.IsDir {
+			return a.IsDir
+		}
+		var less bool
+		switch order {
+		case "time":
+			less = a.ServerMtime < b.ServerMtime
+		case "size":
+			less = a.Size() < b.Size()
+		default:
+			less = a.Name() < b.Name()
+		}
+		if desc {
+			return !less
+		}
+		return less
+	})
+
+	list := []map[string]any{}
+	for i := start; i < len(children) && i < start+limit; i++ {
+		list = append(list, fileRecord(children[i]))
+	}
+	s.writeJSON(w, map[string]any{
+		"errno":      ErrnoOK,
+		"guid":       0,
+		"list":       list,
+		"request_id": s.requestID(),
+	})
+}
+
+func (s *Server) handleListAll(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	p := path.Clean(query.Get("path"))
+	start := intParam(r, "start", 0)
+	limit := intParam(r, "limit", 1000)
+	recursion := query.Get("recursion") == "1"
+
+	s.mu.Lock()
+	f, ok := s.files[p]
+	if !ok {
+		s.mu.Unlock()
+		s.writeErrno(w, ErrnoNotFound, "not found")
+		return
+	}
+	var all []*File
+	if f.IsDir {
+		if recursion {
+			all = s.descendantsLocked(p)
+		} else {
+			all = s.childrenLocked(p)
+		}
+	}
+	s.mu.Unlock()
+
+	list := []map[string]any{}
+	end := start
+	for ; end < len(all) && end < start+limit; end++ {
+		list = append(list, fileRecord(all[end]))
+	}
+	hasMore := 0
+	if end < len(all) {
+		hasMore = 1
+	}
+	s.writeJSON(w, map[string]any{
+		"errno":      ErrnoOK,
+		"errmsg":     "succ",
+		"cursor":     end,
+		"has_more":   hasMore,
+		"list":       list,
+		"request_id": strconv.FormatInt(s.requestID(), 10),
+	})
+}
+
+func (s *Server) handleSearch(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	key := strings.ToLower(query.Get("key"))
+	if key == "" {
+		s.writeErrno(w, ErrnoParam, "key is empty")
+		return
+	}
+	dir := path.Clean(query.Get("dir"))
+	if query.Get("dir") == "" {
+		dir = "/"
+	}
+	wantCategory := intParam(r, "category", 0)
+	page := max(intParam(r, "page", 1), 1)
+	num := intParam(r, "num", 500)
+
+	s.mu.Lock()
+	d, ok := s.files[dir]
+	if !ok || !d.IsDir {
+		s.mu.Unlock()
+		s.writeErrno(w, ErrnoNotFound, "not found")
+		return
+	}
+	var candidates []*File
+	if query.Get("recursion") == "1" {
+		candidates = s.descendantsLocked(dir)
+	} else {
+		candidates = s.childrenLocked(dir)
+	}
+	s.mu.Unlock()
+
+	var hits []*File
+	for _, f := range candidates {
+		if !strings.Contains(strings.ToLower(f.Name()), key) {
+			continue
+		}
+		if wantCategory != 0 && category(f) != wantCategory {
+			continue
+		}
+		hits = append(hits, f)
+	}
+	list := []map[string]any{}
+	start := (page - 1) * num
+	for i := start; i < len(hits) && i < start+num; i++ {
+		list = append(list, fileRecord(hits[i]))
+	}
+	hasMore := 0
+	if start+num < len(hits) {
+		hasMore = 1
+	}
+	s.writeJSON(w, map[string]any{
+		"errno":      ErrnoOK,
+		"list":       list,
+		"has_more":   hasMore,
+		"request_id": strconv.FormatInt(s.requestID(), 10),
+	})
+}
+
+func (s *Server) handleFileMetas(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	var fsIDs []int64
+	if err := json.Unmarshal([]byte(query.Get("fsids")), &fsIDs); err != nil {
+		s.writeErrno(w, ErrnoParam, "fsids invalid")
+		return
+	}
+	// 百度一次最多查 100 个
+	if len(fsIDs) > 100 {
+		s.writeErrno(w, ErrnoParam, "too many fsids")
+		return
+	}
+	withDLink := query.Get("dlink") == "1"
+	withThumb := query.Get("thumb") == "1"
+
+	s.mu.Lock()
+	list := []map[string]any{}
+	for _, fsID := range fsIDs {
+		f, ok := s.findByFsIDLocked(fsID)
+		if !ok {
+			continue
+		}
+		item := fileRecord(f)
+		item["filename"] = f.Name()
+		if len(f.BlockList) > 0 {
+			item["block_list"] = f.BlockList
+		}
+		if withDLink && !f.IsDir {
+			item["dlink"] = fmt.Sprintf("%s/file?fid=%d&gen=%d", s.URL, f.FsID, s.dlinkGeneration)
+		}
+		if withThumb && (category(f) == 1 || category(f) == 3) {
+			item["thumbs"] = map[string]string{
+				"icon": fmt.Sprintf("%s/thumb?fid=%d&size=c60_u60", s.URL, f.FsID),
+				"url1": fmt.Sprintf("%s/thumb?fid=%d&size=c140_u90", s.URL, f.FsID),
+			}
+		}
+		list = append(list, item)
+	}
+	s.mu.Unlock()
+
+	s.writeJSON(w, map[string]any{
+		"errno":      ErrnoOK,
+		"errmsg":     "succ",
+		"list":       list,
+		"request_id": strconv.FormatInt(s.requestID(), 10),
+	})
+}
+
+func (s *Server) handlePreCreate(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		s.writeErrno(w, ErrnoParam, err.Error())
+		return
+	}
+	size, _ := strconv.ParseInt(r.PostForm.Get("size"), 10, 64)
+	var blockList []string
+	if err := json.Unmarshal([]byte(r.PostForm.Get("block_list")), &blockList); err != nil {
+		s.writeErrno(w, ErrnoParam, "block_list invalid")
+		return
+	}
+	p := r.PostForm.Get("path")
+	if p == "" {
+		s.writeErrno(w, ErrnoParam, "path empty")
+		return
+	}
+
+	s.mu.Lock()
+	s.nextID++
+	uploadID := fmt.Sprintf("P1-fake-%d", s.nextID)
+	s.uploads[uploadID] = &uploadSession{
+		path:      path.Clean(p),
+		size:      size,
+		blockList: blockList,
+		parts:     map[int][]byte{},
+	}
+	s.mu.Unlock()
+
+	seqList := make([]int, len(blockList))
+	for i := range seqList {
+		seqList[i] = i
+	}
+	s.writeJSON(w, map[string]any{
+		"errno":       ErrnoOK,
+		"return_type": 1,
+		"block_list":  seqList,
+		"uploadid":    uploadID,
+		"request_id":  s.requestID(),
+	})
+}
+
+func (s *Server) handleSuperfile2(w http.ResponseWriter, r *http.Request) {
+	if s.Token != "" && r.URL.Query().Get("access_token") != s.Token {
+		s.writePCSError(w, ErrnoTokenExpired, "access token expired")
+		return
+	}
+	query := r.URL.Query()
+	if !s.count(w, query.Get("method")) {
+		return
+	}
+	partSeq, err := strconv.Atoi(query.Get("partseq"))
+	if err != nil {
+		s.writePCSError(w, ErrnoParam, "partseq invalid")
+		return
+	}
+	file, _, err := r.FormFile("file")
+	if err != nil {
+		s.writePCSError(w, ErrnoParam, err.Error())
+		return
+	}
+	defer file.Close()
+	data, err := io.ReadAll(file)
+	if err != nil {
+		s.writePCSError(w, ErrnoParam, err.Error())
+		return
+	}
+
+	s.mu.Lock()
+	session, ok := s.uploads[query.Get("uploadid")]
+	if ok {
+		session.parts[partSeq] = data
+	}
+	s.mu.Unlock()
+	if !ok {
+		s.writePCSError(w, ErrnoNoUploadID, "uploadid not found")
+		return
+	}
+	s.writeJSON(w, map[string]any{
+		"md5":        fmt.Sprintf("%x", md5.Sum(data)),
+		"request_id": s.requestID(),
+	})
+}
+
+func (s *Server) handleCreate(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		s.writeErrno(w, ErrnoParam, err.Error())
+		return
+	}
+	p := path.Clean(r.PostForm.Get("path"))
+	size, _ := strconv.ParseInt(r.PostForm.Get("size"), 10, 64)
+	rtype, _ := strconv.Atoi(r.PostForm.Get("rtype"))
+	if r.PostForm.Get("isdir") == "1" {
+		s.handleCreateDir(w, p, rtype)
+		return
+	}
+	var blockList []string
+	if err := json.Unmarshal([]byte(r.PostForm.Get("block_list")), &blockList); err != nil {
+		s.writeErrno(w, ErrnoParam, "block_list invalid")
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	session, ok := s.uploads[r.PostForm.Get("uploadid")]
+	if !ok {
+		s.writeErrno(w, ErrnoNoUploadID, "uploadid not found")
+		return
+	}
+	// 按分片顺序拼出文件，同时核对每个分片的 md5
+	var buf bytes.Buffer
+	for i, blockMD5 := range blockList {
+		part, ok := session.parts[i]
+		if !ok || fmt.Sprintf("%x", md5.Sum(part)) != blockMD5 {
+			s.writeErrno(w, ErrnoParam, fmt.Sprintf("block %d missing or md5 mismatch", i))
+			return
+		}
+		buf.Write(part)
+	}
+	if int64(buf.Len()) != size {
+		s.writeErrno(w, ErrnoParam, "size mismatch")
+		return
+	}
+
+	if existing, ok := s.files[p]; ok {
+		switch {
+		case rtype == 3:
+			// 覆盖
+		case rtype == 2 && existing.MD5 == fmt.Sprintf("%x", md5.Sum(buf.Bytes())):
+			// 内容相同，不需要重命名
+		case rtype == 1 || rtype == 2:
+			p = s.renameLocked(p)
+		default:
+			s.writeErrno(w, ErrnoFileExists, "file already exists")
+			return
+		}
+	}
+	delete(s.uploads, r.PostForm.Get("uploadid"))
+	f := s.putFileLocked(p, buf.Bytes())
+	f.BlockList = blockList
+	s.writeJSON(w, map[string]any{
+		"errno":           ErrnoOK,
+		"fs_id":           f.FsID,
+		"md5":             f.MD5,
+		"server_filename": f.Name(),
+		"category":        category(f),
+		"path":            f.Path,
+		"size":            f.Size(),
+		"ctime":           f.ServerCtime,
+		"mtime":           f.ServerMtime,
+		"isdir":           0,
+	})
+}
+
+// renameLocked 路径冲突时，在文件名后加序号来重命名
+// handleCreateDir 创建文件夹，父文件夹会自动创建
+func (s *Server) handleCreateDir(w http.ResponseWriter, p string, rtype int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.files[p]; ok {
+		if rtype == 0 {
+			s.writeErrno(w, ErrnoFileExists, "file already exists")
+			return
+		}
+		p = s.renameLocked(p)
+	}
+	f := s.mkdirLocked(p)
+	s.writeJSON(w, map[string]any{
+		"errno":    ErrnoOK,
+		"fs_id":    f.FsID,
+		"path":     f.Path,
+		"ctime":    f.ServerCtime,
+		"mtime":    f.ServerMtime,
+		"isdir":    1,
+		"category": 6,
+	})
+}
+
+func (s *Server) renameLocked(p string) string {
+	ext := path.Ext(p)
+	base := strings.TrimSuffix(p, ext)
+	for i := 1; ; i++ {
+		candidate := fmt.Sprintf("%s_%d%s", base, i, ext)
+		if _, ok := s.files[candidate]; !ok {
+			return candidate
+		}
+	}
+}
+
+// handleDownload dlink 指向的下载地址，支持 Range
+func (s *Server) handleDownload(w http.ResponseWriter, r *http.Request) {
+	if !s.checkToken(w, r) {
+		return
+	}
+	if !s.count(w, "download") {
+		return
+	}
+	if r.Header.Get("User-Agent") != "pan.baidu.com" {
+		http.Error(w, "user agent not allowed", http.StatusForbidden)
+		return
+	}
+	fsID, err := strconv.ParseInt(r.URL.Query().Get("fid"), 10, 64)
+	if err != nil {
+		http.Error(w, "fid invalid", http.StatusBadRequest)
+		return
+	}
+	s.mu.Lock()
+	expired := r.URL.Query().Get("gen") != strconv.Itoa(s.dlinkGeneration)
+	if expired {
+		s.requests["dlink_expired"]++
+	} else if s.expireDLinksAfter > 0 {
+		s.expireDLinksAfter--
+		if s.expireDLinksAfter == 0 {
+			s.dlinkGeneration++
+		}
+	}
+	f, ok := s.findByFsIDLocked(fsID)
+	s.mu.Unlock()
+	if expired {
+		http.Error(w, "link expired", http.StatusForbidden)
+		return
+	}
+	if !ok || f.IsDir {
+		http.NotFound(w, r)
+		return
+	}
+	http.ServeContent(w, r, f.Name(), time.Unix(f.ServerMtime, 0), bytes.NewReader(f.Data))
+}
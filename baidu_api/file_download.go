@@ -0,0 +1,245 @@
+package baidu_api
+
+import (
+	"baidu_tool/utils"
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// 下载中的文件的后缀，下载完成后改名去掉
+const (
+	// partSuffix 预分配好大小的下载中文件
+	partSuffix = ".part"
+	// journalSuffix 记录 .part 文件中哪些分片已经写好
+	journalSuffix = ".part.json"
+)
+
+// downloadJournal 写在 .part.json 中的下载记录，网盘文件或分片大小变了就不能继续使用
+type downloadJournal struct {
+	FsID      int64  `json:"fs_id"`
+	Size      int64  `json:"size"`
+	MD5       string `json:"md5"`
+	RangeSize int64  `json:"range_size"`
+	// Ranges 已经写入 .part 文件并落盘的分片
+	Ranges []journalRange `json:"ranges"`
+}
+
+// journalRange 一个已完成的分片和它内容的 md5，续传前会重新校验
+type journalRange struct {
+	Index int    `json:"index"`
+	MD5   string `json:"md5"`
+}
+
+// fileDownload 一个文件的下载过程，多个分片协程同时写入 file 的不同位置
+type fileDownload struct {
+	info      *DownloadInfo
+	localPath string
+	rangeSize int64
+	file      *os.File
+	// transferred 已经写好的字节数
+	transferred atomic.Int64
+
+	// mu 保护 completed、err 和记录文件的写入
+	mu sync.Mutex
+	// completed 已完成的分片序号和内容的 md5
+	completed map[int]string
+	// err 第一个重试后仍然失败的分片的错误，有了之后这个文件就放弃了
+	err error
+}
+
+// openFileDownload 打开 localPath.part 准备下载，有这个网盘文件的下载记录时，校验通过的分片不再下载，否则重新预分配
+func (c *Client) openFileDownload(info *DownloadInfo, localPath string) (*fileDownload, error) {
+	d := &fileDownload{
+		info:      info,
+		localPath: localPath,
+		rangeSize: c.DownloadSliceSize,
+		completed: map[int]string{},
+	}
+	if err := os.MkdirAll(filepath.Dir(localPath), 0750); err != nil {
+		return nil, err
+	}
+	partPath := localPath + partSuffix
+	if journal, ok := d.loadJournal(); ok {
+		file, err := os.OpenFile(partPath, os.O_RDWR, 0)
+		if err == nil {
+			if fileInfo, err := file.Stat(); err == nil && fileInfo.Size() == info.Size {
+				d.file = file
+				d.verifyRanges(journal.Ranges)
+				if err = d.saveJournal(); err != nil {
+					_ = file.Close()
+					return nil, err
+				}
+				return d, nil
+			}
+			_ = file.Close()
+		}
+	}
+
+	// 重新开始
+	file, err := os.OpenFile(partPath, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0666)
+	if err != nil {
+		return nil, err
+	}
+	if err = file.Truncate(info.Size); err != nil {
+		_ = file.Close()
+		return nil, err
+	}
+	d.file = file
+	if err = d.saveJournal(); err != nil {
+		_ = file.Close()
+		return nil, err
+	}
+	return d, nil
+}
+
+// loadJournal 读取上次的下载记录，是同一个网盘文件并且分片大小一致时才能使用
+func (d *fileDownload) loadJournal() (*downloadJournal, bool) {
+	content, err := os.ReadFile(d.localPath + journalSuffix)
+	if err != nil {
+		return nil, false
+	}
+	var journal downloadJournal
+	if err = json.Unmarshal(content, &journal); err != nil {
+		return nil, false
+	}
+	if journal.FsID != d.info.FsID || journal.Size != d.info.Size || journal.MD5 != d.info.MD5 || journal.RangeSize != d.rangeSize {
+		return nil, false
+	}
+	return &journal, true
+}
+
+// verifyRanges 重新计算记录中每个分片在 .part 文件里的 md5，一致的才算完成，崩溃时没写完的分片会重新下载
+func (d *fileDownload) verifyRanges(ranges []journalRange) {
+	for _, r := range ranges {
+		if r.Index < 0 || r.Index >= d.rangeCount() {
+			continue
+		}
+		offset, length := d.rangeBounds(r.Index)
+		hash := md5.New()
+		if _, err := io.Copy(hash, io.NewSectionReader(d.file, offset, length)); err != nil {
+			continue
+		}
+		if hex.EncodeToString(hash.Sum(nil)) != r.MD5 {
+			continue
+		}
+		d.completed[r.Index] = r.MD5
+		d.transferred.Add(length)
+	}
+}
+
+// saveJournal 先写临时文件再改名，崩溃时记录文件要么是旧的要么是新的，调用方需要持有 mu 或者还没有开始并发
+func (d *fileDownload) saveJournal() error {
+	journal := downloadJournal{
+		FsID:      d.info.FsID,
+		Size:      d.info.Size,
+		MD5:       d.info.MD5,
+		RangeSize: d.rangeSize,
+		Ranges:    make([]journalRange, 0, len(d.completed)),
+	}
+	for i, checksum := range d.completed {
+		journal.Ranges = append(journal.Ranges, journalRange{Index: i, MD5: checksum})
+	}
+	sort.Slice(journal.Ranges, func(i, j int) bool {
+		return journal.Ranges[i].Index < journal.Ranges[j].Index
+	})
+	content, err := json.Marshal(journal)
+	if err != nil {
+		return err
+	}
+	return utils.WriteFileAtomic(d.localPath+journalSuffix, content, 0644)
+}
+
+// rangeCount 分片数量，空文件没有分片
+func (d *fileDownload) rangeCount() int {
+	return int((d.info.Size + d.rangeSize - 1) / d.rangeSize)
+}
+
+// rangeBounds 第 i 个分片的开始位置和长度，最后一个是剩下的大小
+func (d *fileDownload) rangeBounds(i int) (offset int64, length int64) {
+	offset = int64(i) * d.rangeSize
+	return offset, min(d.rangeSize, d.info.Size-offset)
+}
+
+func (d *fileDownload) isCompleted(i int) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	_, ok := d.completed[i]
+	return ok
+}
+
+func (d *fileDownload) allCompleted() bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return len(d.completed) == d.rangeCount()
+}
+
+// fail 记下分片失败的原因，是这个文件第一个失败的分片时返回 true
+func (d *fileDownload) fail(err error) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.err != nil {
+		return false
+	}
+	d.err = err
+	return true
+}
+
+// failure 这个文件失败的原因，没有失败时为 nil
+func (d *fileDownload) failure() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.err
+}
+
+// markCompleted 第 i 个分片已经写好，先让内容落盘再记录下来，记录中的分片一定是完整的
+func (d *fileDownload) markCompleted(i int, checksum string) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if err := d.file.Sync(); err != nil {
+		return err
+	}
+	d.completed[i] = checksum
+	return d.saveJournal()
+}
+
+// verify 用网盘的 md5 核对整个 .part 文件，不一致时删除 .part 文件和下载记录，下次从头下载
+// 返回错误时 .part 文件已经关闭，通过时由 finish 关闭
+func (d *fileDownload) verify() error {
+	hash := md5.New()
+	if _, err := io.Copy(hash, io.NewSectionReader(d.file, 0, d.info.Size)); err != nil {
+		_ = d.file.Close()
+		return err
+	}
+	if strings.EqualFold(hex.EncodeToString(hash.Sum(nil)), d.info.MD5) {
+		return nil
+	}
+	_ = d.file.Close()
+	_ = os.Remove(d.localPath + partSuffix)
+	_ = os.Remove(d.localPath + journalSuffix)
+	return fmt.Errorf("%s: %w", d.info.Path, ErrChecksumMismatch)
+}
+
+// finish 所有分片都写好后，落盘并改名成最终文件，删除下载记录
+func (d *fileDownload) finish() error {
+	syncErr := d.file.Sync()
+	if err := errors.Join(syncErr, d.file.Close()); err != nil {
+		return err
+	}
+	if err := os.Rename(d.localPath+partSuffix, d.localPath); err != nil {
+		return err
+	}
+	if err := os.Remove(d.localPath + journalSuffix); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
@@ -1,11 +1,9 @@
 package baidu_api
 
 import (
-	"encoding/json"
-	"fmt"
-	"io"
-	"net/http"
+	"context"
 	"net/url"
+	"strconv"
 )
 
 // DirRecursiveResp 接口文件夹返回
@@ -13,11 +11,15 @@ type DirRecursiveResp struct {
 	Errno     int          `json:"errno"`
 	Cursor    int          `json:"cursor"`
 	List      []*FileOrDir `json:"list"`
-	RequestID string       `json:"request_id"`
+	RequestID RequestID    `json:"request_id"`
 	HasMore   int8         `json:"has_more"`
 	Errmsg    string       `json:"errmsg"`
 }
 
+func (r *DirRecursiveResp) apiError(endpoint string) error {
+	return checkErrno(endpoint, r.Errno, r.Errmsg, r.RequestID)
+}
+
 // FileOrDir 文件或文件夹结构
 type FileOrDir struct {
 	IsDir          int8   `json:"isdir"`
@@ -26,61 +28,188 @@ type FileOrDir struct {
 	ServerFilename string `json:"server_filename"`
 	FsId           int64  `json:"fs_id"`
 	MD5            string `json:"md5"`
+	Category       int    `json:"category"`
+	ServerCtime    int64  `json:"server_ctime"`
+	ServerMtime    int64  `json:"server_mtime"`
 }
 
-// GetFileOrDirResp 获取到路径所指的文件或文件夹的接口返回
-func GetFileOrDirResp(accessToken string, filePath string) (*DirRecursiveResp, error) {
-	preUrl := "http://pan.baidu.com/rest/2.0/xpan/multimedia?method=listall&access_token=%s&path=%s&recursion=1"
-	_url := fmt.Sprintf(preUrl, accessToken, url.PathEscape(filePath))
-	resp, err := http.Get(_url)
-	if err != nil {
-		return nil, err
+// defaultListAllLimit listall 接口每次默认返回的数量
+const defaultListAllLimit = 1000
+
+// ListAllPage 递归列出路径下从 start 开始的最多 limit 个文件和文件夹，下一页从返回的 Cursor 开始，HasMore 为 0 时取完
+func (c *Client) ListAllPage(ctx context.Context, filePath string, start int, limit int) (*DirRecursiveResp, error) {
+	if limit <= 0 {
+		limit = defaultListAllLimit
 	}
-	defer resp.Body.Close()
-	respBytes, err := io.ReadAll(resp.Body)
-	if err != nil {
+	params := url.Values{}
+	params.Set("method", "listall")
+	params.Set("path", filePath)
+	params.Set("recursion", "1")
+	params.Set("start", strconv.Itoa(start))
+	params.Set("limit", strconv.Itoa(limit))
+	var dirResp DirRecursiveResp
+	if err := getJSON(ctx, c, "multimedia/listall", c.panURL("/rest/2.0/xpan/multimedia", params), &dirResp); err != nil {
 		return nil, err
 	}
+	return &dirResp, nil
+}
+
+// ListAllIterator 逐个遍历 listall 的结果，一次只在内存中保留一页，用法和 bufio.Scanner 一样：
+//
+//	it := c.ListAll(ctx, "/apps/data", 0)
+//	for it.Next() {
+//		item := it.Item()
+//	}
+//	if err := it.Err(); err != nil {
+//	}
+type ListAllIterator struct {
+	ctx      context.Context
+	client   *Client
+	filePath string
+	limit    int
+	// page 当前页，index 是当前项在页中的位置
+	page  []*FileOrDir
+	index int
+	// cursor 下一页的开始位置
+	cursor  int
+	hasMore bool
+	item    *FileOrDir
+	err     error
+}
+
+// ListAll 递归遍历路径下所有的文件和文件夹，每次请求 limit 个，不大于 0 时为 1000，路径是文件时没有结果
+func (c *Client) ListAll(ctx context.Context, filePath string, limit int) *ListAllIterator {
+	return &ListAllIterator{
+		ctx:      ctx,
+		client:   c,
+		filePath: filePath,
+		limit:    limit,
+		hasMore:  true,
+	}
+}
+
+// Next 前进到下一项，没有更多或者出错时返回 false
+func (it *ListAllIterator) Next() bool {
+	for it.index >= len(it.page) {
+		if !it.hasMore || it.err != nil {
+			it.item = nil
+			return false
+		}
+		resp, err := it.client.ListAllPage(it.ctx, it.filePath, it.cursor, it.limit)
+		if err != nil {
+			it.err = err
+			it.item = nil
+			return false
+		}
+		it.page, it.index = resp.List, 0
+		// 游标没有前进时不再请求，避免死循环
+		it.hasMore = resp.HasMore == 1 && resp.Cursor > it.cursor
+		it.cursor = resp.Cursor
+	}
+	it.item = it.page[it.index]
+	it.index++
+	return true
+}
+
+// Item 当前项
+func (it *ListAllIterator) Item() *FileOrDir {
+	return it.item
+}
+
+// Err 遍历中遇到的错误
+func (it *ListAllIterator) Err() error {
+	return it.err
+}
+
+// GetFileOrDirResp 获取到路径所指的文件或文件夹下的所有内容，按游标翻页直到取完，每次请求 limit 个，不大于 0 时为 1000
+func (c *Client) GetFileOrDirResp(ctx context.Context, filePath string, limit int) (*DirRecursiveResp, error) {
 	var dirResp DirRecursiveResp
-	if err = json.Unmarshal(respBytes, &dirResp); err != nil {
-		return nil, err
+	it := c.ListAll(ctx, filePath, limit)
+	for it.Next() {
+		dirResp.List = append(dirResp.List, it.Item())
 	}
-	if dirResp.Errno != 0 {
-		return nil, fmt.Errorf("dir resp not right")
+	if err := it.Err(); err != nil {
+		return nil, err
 	}
+	dirResp.Cursor = it.cursor
 	return &dirResp, nil
 }
 
 // DirListResp 接口文件夹列表返回
 type DirListResp struct {
 	Errno     int          `json:"errno"`
+	Errmsg    string       `json:"errmsg"`
 	List      []*FileOrDir `json:"list"`
-	RequestID int64        `json:"request_id"`
+	RequestID RequestID    `json:"request_id"`
 	Guid      int          `json:"guid"`
 }
 
-// GetDirByList 使用列表方法，非递归，获取一个文件夹下的文件信息，递归最多 1000 个下级信息
-func GetDirByList(accessToken string, dirPath string) (*DirListResp, error) {
-	preUrl := "http://pan.baidu.com/rest/2.0/xpan/file?method=list&access_token=%s&dir=%s"
-	_url := fmt.Sprintf(preUrl, accessToken, url.PathEscape(dirPath))
-	resp, err := http.Get(_url)
-	if err != nil {
-		return nil, err
+func (r *DirListResp) apiError(endpoint string) error {
+	return checkErrno(endpoint, r.Errno, r.Errmsg, r.RequestID)
+}
+
+// defaultListPageSize list 接口每页最多返回的数量
+const defaultListPageSize = 1000
+
+// ListOptions list 接口的排序和分页
+type ListOptions struct {
+	// Order 排序字段：name、time、size，为空时按文件名
+	Order string
+	// Desc 是否降序
+	Desc bool
+	// PageSize 每页多少个，不大于 0 时为 1000
+	PageSize int
+}
+
+// ListDirPage 使用列表方法，非递归，获取文件夹下从 start 开始的一页
+func (c *Client) ListDirPage(ctx context.Context, dirPath string, opts ListOptions, start int) (*DirListResp, error) {
+	pageSize := opts.PageSize
+	if pageSize <= 0 {
+		pageSize = defaultListPageSize
 	}
-	defer resp.Body.Close()
-	respBytes, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return nil, err
+	params := url.Values{}
+	params.Set("method", "list")
+	params.Set("dir", dirPath)
+	params.Set("start", strconv.Itoa(start))
+	params.Set("limit", strconv.Itoa(pageSize))
+	if opts.Order != "" {
+		params.Set("order", opts.Order)
+	}
+	if opts.Desc {
+		params.Set("desc", "1")
 	}
 	var dirResp DirListResp
-	if err = json.Unmarshal(respBytes, &dirResp); err != nil {
+	if err := getJSON(ctx, c, "file/list", c.panURL("/rest/2.0/xpan/file", params), &dirResp); err != nil {
 		return nil, err
 	}
-	if dirResp.Errno != 0 {
-		if dirResp.Errno == -9 {
-			return nil, fmt.Errorf("NOT_FOUND")
+	return &dirResp, nil
+}
+
+// ListDir 列出文件夹下全部的文件和文件夹，自动翻页直到取完
+// 服务端每页返回的数量可能比要求的少，不能用不满一页判断取完
+func (c *Client) ListDir(ctx context.Context, dirPath string, opts ListOptions) ([]*FileOrDir, error) {
+	var list []*FileOrDir
+	// fullPage 上一页的数量，就是服务端实际一页给的数量
+	fullPage := 0
+	for {
+		page, err := c.ListDirPage(ctx, dirPath, opts, len(list))
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, page.List...)
+		// 空页，或者比前面的整页少，说明取完了
+		if len(page.List) == 0 || len(page.List) < fullPage {
+			return list, nil
 		}
-		return nil, fmt.Errorf("dir resp not right")
+		fullPage = len(page.List)
 	}
-	return &dirResp, nil
+}
+
+// GetDirByList 使用列表方法，非递归，获取一个文件夹下全部的文件信息，超过一页时自动翻页
+func (c *Client) GetDirByList(ctx context.Context, dirPath string) (*DirListResp, error) {
+	list, err := c.ListDir(ctx, dirPath, ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+	return &DirListResp{List: list}, nil
 }
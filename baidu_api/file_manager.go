@@ -0,0 +1,128 @@
+package baidu_api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strconv"
+)
+
+// 文件已存在时的处理方式
+const (
+	// OndupFail 直接失败
+	OndupFail = "fail"
+	// OndupNewCopy 重命名后保存
+	OndupNewCopy = "newcopy"
+	// OndupOverwrite 覆盖
+	OndupOverwrite = "overwrite"
+	// OndupSkip 跳过
+	OndupSkip = "skip"
+)
+
+// errnoBatchFailed 批量操作中有失败的项，具体原因在每一项的 errno 里
+const errnoBatchFailed = 12
+
+// FileOperation 复制、移动、重命名的一项
+type FileOperation struct {
+	// Path 源文件路径
+	Path string `json:"path"`
+	// Dest 目标文件夹，重命名时不需要
+	Dest string `json:"dest,omitempty"`
+	// NewName 新的文件名
+	NewName string `json:"newname"`
+}
+
+// FileManagerInfo 批量操作中每一项的结果
+type FileManagerInfo struct {
+	Errno int    `json:"errno"`
+	Path  string `json:"path"`
+}
+
+// FileManagerResp 文件管理接口的返回
+type FileManagerResp struct {
+	Errno     int               `json:"errno"`
+	Errmsg    string            `json:"errmsg"`
+	Info      []FileManagerInfo `json:"info"`
+	TaskID    int64             `json:"taskid"`
+	RequestID RequestID         `json:"request_id"`
+}
+
+// apiError 批量操作失败时返回第一个失败项的错误码，方便用 errors.Is 判断原因
+func (r *FileManagerResp) apiError(endpoint string) error {
+	if r.Errno == errnoBatchFailed {
+		for _, info := range r.Info {
+			if info.Errno != 0 {
+				return checkErrno(endpoint, info.Errno, fmt.Sprintf("%s failed", info.Path), r.RequestID)
+			}
+		}
+	}
+	return checkErrno(endpoint, r.Errno, r.Errmsg, r.RequestID)
+}
+
+// fileManager 同步执行文件管理操作，opera 为 delete、move、copy、rename
+func (c *Client) fileManager(ctx context.Context, opera string, fileList any, ondup string) (*FileManagerResp, error) {
+	params := url.Values{}
+	params.Set("method", "filemanager")
+	params.Set("opera", opera)
+	realUrl := c.panURL("/rest/2.0/xpan/file", params)
+
+	bts, err := json.Marshal(fileList)
+	if err != nil {
+		return nil, err
+	}
+	body := url.Values{}
+	// 0 为同步，操作完成后才返回
+	body.Set("async", strconv.Itoa(0))
+	body.Set("filelist", string(bts))
+	if ondup != "" {
+		body.Set("ondup", ondup)
+	}
+	ret := &FileManagerResp{}
+	if err = postForm(ctx, c, "file/filemanager/"+opera, realUrl, body, ret); err != nil {
+		return ret, err
+	}
+	return ret, nil
+}
+
+// Delete 删除文件或文件夹，文件夹会连同里面的内容一起删除
+func (c *Client) Delete(ctx context.Context, paths []string) error {
+	_, err := c.fileManager(ctx, "delete", paths, "")
+	return err
+}
+
+// Move 移动文件或文件夹到 Dest 文件夹下并命名为 NewName，ondup 为空时按 OndupFail 处理
+func (c *Client) Move(ctx context.Context, operations []FileOperation, ondup string) error {
+	_, err := c.fileManager(ctx, "move", operations, ondup)
+	return err
+}
+
+// Copy 复制文件或文件夹到 Dest 文件夹下并命名为 NewName，ondup 为空时按 OndupFail 处理
+func (c *Client) Copy(ctx context.Context, operations []FileOperation, ondup string) error {
+	_, err := c.fileManager(ctx, "copy", operations, ondup)
+	return err
+}
+
+// Rename 在原文件夹中重命名
+func (c *Client) Rename(ctx context.Context, filePath string, newName string) error {
+	_, err := c.fileManager(ctx, "rename", []FileOperation{{Path: filePath, NewName: newName}}, "")
+	return err
+}
+
+// Mkdir 创建文件夹，已存在时返回 ErrFileExists
+func (c *Client) Mkdir(ctx context.Context, dirPath string) (*CreateReturn, error) {
+	params := url.Values{}
+	params.Set("method", "create")
+	realUrl := c.panURL("/rest/2.0/xpan/file", params)
+
+	body := url.Values{}
+	body.Add("path", dirPath)
+	body.Add("isdir", "1")
+	// 0 为不重命名，同名时报错
+	body.Add("rtype", "0")
+	ret := &CreateReturn{}
+	if err := postForm(ctx, c, "file/create", realUrl, body, ret); err != nil {
+		return ret, err
+	}
+	return ret, nil
+}
@@ -0,0 +1,141 @@
+package baidu_api
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// maxFileMetasBatch filemetas 接口每次最多查询的 fs_id 数量
+const maxFileMetasBatch = 100
+
+// FileMeta filemetas 接口返回的文件详细信息
+type FileMeta struct {
+	FsID        int64  `json:"fs_id"`
+	Path        string `json:"path"`
+	Filename    string `json:"filename"`
+	IsDir       int8   `json:"isdir"`
+	Size        int64  `json:"size"`
+	MD5         string `json:"md5"`
+	Category    int    `json:"category"`
+	ServerCtime int64  `json:"server_ctime"`
+	ServerMtime int64  `json:"server_mtime"`
+	LocalCtime  int64  `json:"local_ctime"`
+	LocalMtime  int64  `json:"local_mtime"`
+	// DLink 下载地址，需要 FileMetasOptions.DLink
+	DLink string `json:"dlink,omitempty"`
+	// Thumbs 图片和视频的缩略图地址，需要 FileMetasOptions.Thumb
+	Thumbs map[string]string `json:"thumbs,omitempty"`
+	// BlockList 分片的 md5 列表，百度只对部分文件返回
+	BlockList []string `json:"block_list,omitempty"`
+}
+
+// FileMetasResp 查询文件信息接口返回
+type FileMetasResp struct {
+	Errno     int         `json:"errno"`
+	Errmsg    string      `json:"errmsg"`
+	List      []*FileMeta `json:"list"`
+	RequestID RequestID   `json:"request_id"`
+}
+
+func (r *FileMetasResp) apiError(endpoint string) error {
+	return checkErrno(endpoint, r.Errno, r.Errmsg, r.RequestID)
+}
+
+// FileMetasOptions filemetas 接口额外要返回的信息
+type FileMetasOptions struct {
+	// DLink 返回下载地址
+	DLink bool
+	// Thumb 返回缩略图地址
+	Thumb bool
+	// Extra 返回图片的拍摄时间、分辨率等信息
+	Extra bool
+}
+
+// fileMetasURL 查询一批 fs_id 的 filemetas 接口地址
+func (c *Client) fileMetasURL(fsIDList []int64, opts FileMetasOptions) string {
+	strFsIDList := make([]string, 0, len(fsIDList))
+	for _, fsID := range fsIDList {
+		strFsIDList = append(strFsIDList, strconv.FormatInt(fsID, 10))
+	}
+	params := url.Values{}
+	params.Set("method", "filemetas")
+	params.Set("fsids", "["+strings.Join(strFsIDList, ",")+"]")
+	if opts.DLink {
+		params.Set("dlink", "1")
+	}
+	if opts.Thumb {
+		params.Set("thumb", "1")
+	}
+	if opts.Extra {
+		params.Set("extra", "1")
+	}
+	return c.panURL("/rest/2.0/xpan/multimedia", params)
+}
+
+// FileMetas 按 fs_id 查询文件的详细信息，超过 100 个时分批查询，不存在的 fs_id 不会出现在结果中
+func (c *Client) FileMetas(ctx context.Context, fsIDList []int64, opts FileMetasOptions) ([]*FileMeta, error) {
+	var list []*FileMeta
+	for start := 0; start < len(fsIDList); start += maxFileMetasBatch {
+		batch := fsIDList[start:min(start+maxFileMetasBatch, len(fsIDList))]
+		var metasResp FileMetasResp
+		if err := getJSON(ctx, c, "multimedia/filemetas", c.fileMetasURL(batch, opts), &metasResp); err != nil {
+			return nil, err
+		}
+		list = append(list, metasResp.List...)
+	}
+	return list, nil
+}
+
+// StatPaths 按网盘路径查询文件或文件夹的详细信息，结果和 paths 一一对应，通过列出上一层文件夹找到 fs_id
+func (c *Client) StatPaths(ctx context.Context, paths []string, opts FileMetasOptions) ([]*FileMeta, error) {
+	// 同一个文件夹下的只列一次
+	fsIDs := map[string]int64{}
+	listed := map[string]bool{}
+	for _, p := range paths {
+		p = path.Clean(p)
+		parent := path.Dir(p)
+		if p == "/" {
+			return nil, fmt.Errorf("%s: root has no fs_id", p)
+		}
+		if listed[parent] {
+			continue
+		}
+		listed[parent] = true
+		list, err := c.ListDir(ctx, parent, ListOptions{})
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", p, err)
+		}
+		for _, item := range list {
+			fsIDs[item.Path] = item.FsId
+		}
+	}
+	fsIDList := make([]int64, 0, len(paths))
+	for _, p := range paths {
+		fsID, ok := fsIDs[path.Clean(p)]
+		if !ok {
+			return nil, fmt.Errorf("%s: %w", p, ErrPathNotFound)
+		}
+		fsIDList = append(fsIDList, fsID)
+	}
+	metas, err := c.FileMetas(ctx, fsIDList, opts)
+	if err != nil {
+		return nil, err
+	}
+	byFsID := map[int64]*FileMeta{}
+	for _, meta := range metas {
+		byFsID[meta.FsID] = meta
+	}
+	result := make([]*FileMeta, 0, len(paths))
+	for i, fsID := range fsIDList {
+		meta, ok := byFsID[fsID]
+		if !ok {
+			return nil, fmt.Errorf("%s: %w", paths[i], ErrPathNotFound)
+		}
+		result = append(result, meta)
+	}
+	return result, nil
+}
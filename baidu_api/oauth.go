@@ -0,0 +1,175 @@
+package baidu_api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"time"
+)
+
+// DefaultOAuthScope 网盘开放平台需要的授权范围
+const DefaultOAuthScope = "basic,netdisk"
+
+// defaultDevicePollInterval 百度没返回轮询间隔时使用的间隔
+const defaultDevicePollInterval = 5 * time.Second
+
+// Credentials 身份凭证，刷新 access_token 需要应用的 AppKey 和 SecretKey
+type Credentials struct {
+	AppKey       string    `json:"app_key,omitempty"`
+	SecretKey    string    `json:"secret_key,omitempty"`
+	AccessToken  string    `json:"access_token"`
+	RefreshToken string    `json:"refresh_token,omitempty"`
+	ExpiresAt    time.Time `json:"expires_at,omitempty"`
+	Scope        string    `json:"scope,omitempty"`
+}
+
+// OAuthError 授权接口返回的错误，如 authorization_pending、expired_token
+type OAuthError struct {
+	Code        string
+	Description string
+}
+
+func (e *OAuthError) Error() string {
+	if e.Description == "" {
+		return "baidu oauth " + e.Code
+	}
+	return fmt.Sprintf("baidu oauth %s: %s", e.Code, e.Description)
+}
+
+// oauthErrorResp 授权接口的错误部分
+type oauthErrorResp struct {
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description"`
+}
+
+func (r *oauthErrorResp) apiError(string) error {
+	if r.Error == "" {
+		return nil
+	}
+	return &OAuthError{Code: r.Error, Description: r.ErrorDescription}
+}
+
+// DeviceCode 设备码授权的第一步返回，用户需要打开 VerificationURL 输入 UserCode
+type DeviceCode struct {
+	oauthErrorResp
+	DeviceCode      string `json:"device_code"`
+	UserCode        string `json:"user_code"`
+	VerificationURL string `json:"verification_url"`
+	QrcodeURL       string `json:"qrcode_url"`
+	ExpiresIn       int    `json:"expires_in"`
+	Interval        int    `json:"interval"`
+}
+
+// TokenResp 换取或刷新 access_token 的返回
+type TokenResp struct {
+	oauthErrorResp
+	AccessToken  string `json:"access_token"`
+	RefreshToken string `json:"refresh_token"`
+	ExpiresIn    int64  `json:"expires_in"`
+	Scope        string `json:"scope"`
+}
+
+// credentials 把 token 返回转成凭证，过期时间从现在算起
+func (r *TokenResp) credentials(appKey string, secretKey string) *Credentials {
+	return &Credentials{
+		AppKey:       appKey,
+		SecretKey:    secretKey,
+		AccessToken:  r.AccessToken,
+		RefreshToken: r.RefreshToken,
+		ExpiresAt:    time.Now().Add(time.Duration(r.ExpiresIn) * time.Second),
+		Scope:        r.Scope,
+	}
+}
+
+// oauthURL 拼接授权接口地址，授权接口不需要 access_token
+func (c *Client) oauthURL(path string, params url.Values) string {
+	return c.OAuthBaseURL + path + "?" + params.Encode()
+}
+
+// RequestDeviceCode 设备码授权第一步，获取设备码和用户码
+func (c *Client) RequestDeviceCode(ctx context.Context, appKey string, scope string) (*DeviceCode, error) {
+	if scope == "" {
+		scope = DefaultOAuthScope
+	}
+	params := url.Values{}
+	params.Set("response_type", "device_code")
+	params.Set("client_id", appKey)
+	params.Set("scope", scope)
+	var deviceCode DeviceCode
+	if err := getJSON(ctx, c, "oauth/device/code", c.oauthURL("/oauth/2.0/device/code", params), &deviceCode); err != nil {
+		return nil, err
+	}
+	return &deviceCode, nil
+}
+
+// PollDeviceToken 设备码授权第二步，用户还没授权时返回 Code 为 authorization_pending 的 OAuthError
+func (c *Client) PollDeviceToken(ctx context.Context, appKey string, secretKey string, deviceCode string) (*Credentials, error) {
+	params := url.Values{}
+	params.Set("grant_type", "device_token")
+	params.Set("code", deviceCode)
+	params.Set("client_id", appKey)
+	params.Set("client_secret", secretKey)
+	var tokenResp TokenResp
+	if err := getJSON(ctx, c, "oauth/token", c.oauthURL("/oauth/2.0/token", params), &tokenResp); err != nil {
+		return nil, err
+	}
+	return tokenResp.credentials(appKey, secretKey), nil
+}
+
+// RequestRefreshToken 用 refresh_token 换取新的 access_token，百度会同时返回新的 refresh_token，旧的随即失效
+func (c *Client) RequestRefreshToken(ctx context.Context, appKey string, secretKey string, refreshToken string) (*Credentials, error) {
+	params := url.Values{}
+	params.Set("grant_type", "refresh_token")
+	params.Set("refresh_token", refreshToken)
+	params.Set("client_id", appKey)
+	params.Set("client_secret", secretKey)
+	var tokenResp TokenResp
+	if err := getJSON(ctx, c, "oauth/token", c.oauthURL("/oauth/2.0/token", params), &tokenResp); err != nil {
+		return nil, err
+	}
+	return tokenResp.credentials(appKey, secretKey), nil
+}
+
+// DeviceLogin 走完设备码授权流程：拿到设备码后调用 prompt 提示用户去授权，然后按间隔轮询直到用户授权、拒绝或设备码过期
+func (c *Client) DeviceLogin(ctx context.Context, appKey string, secretKey string, scope string, prompt func(*DeviceCode)) (*Credentials, error) {
+	deviceCode, err := c.RequestDeviceCode(ctx, appKey, scope)
+	if err != nil {
+		return nil, err
+	}
+	prompt(deviceCode)
+
+	interval := time.Duration(deviceCode.Interval) * time.Second
+	if interval <= 0 {
+		interval = defaultDevicePollInterval
+	}
+	if deviceCode.ExpiresIn > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, time.Duration(deviceCode.ExpiresIn)*time.Second)
+		defer cancel()
+	}
+	for {
+		credentials, err := c.PollDeviceToken(ctx, appKey, secretKey, deviceCode.DeviceCode)
+		if err == nil {
+			return credentials, nil
+		}
+		var oauthErr *OAuthError
+		if !errors.As(err, &oauthErr) {
+			return nil, err
+		}
+		switch oauthErr.Code {
+		case "authorization_pending":
+		case "slow_down":
+			// 轮询太快，按协议加 5 秒
+			interval += 5 * time.Second
+		default:
+			return nil, err
+		}
+		if err = sleepContext(ctx, interval); err != nil {
+			if errors.Is(err, context.DeadlineExceeded) {
+				return nil, fmt.Errorf("device code expired before authorization: %w", err)
+			}
+			return nil, err
+		}
+	}
+}
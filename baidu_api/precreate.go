@@ -1,11 +1,10 @@
-package upload
+package baidu_api
 
 import (
 	"baidu_tool/utils"
+	"context"
 	"encoding/json"
 	"fmt"
-	"io"
-	"net/http"
 	"net/url"
 	"os"
 	"strconv"
@@ -13,11 +12,16 @@ import (
 )
 
 type PreCreateReturn struct {
-	Errno      int    `json:"errno"`
-	ReturnType int    `json:"return_type"`
-	BlockList  []int  `json:"block_list"` // 分片序号列表
-	UploadId   string `json:"uploadid"`
-	RequestId  int    `json:"request_id"`
+	Errno      int       `json:"errno"`
+	Errmsg     string    `json:"errmsg"`
+	ReturnType int       `json:"return_type"`
+	BlockList  []int     `json:"block_list"` // 分片序号列表
+	UploadId   string    `json:"uploadid"`
+	RequestId  RequestID `json:"request_id"`
+}
+
+func (r *PreCreateReturn) apiError(endpoint string) error {
+	return checkErrno(endpoint, r.Errno, r.Errmsg, r.RequestId)
 }
 
 type PreCreateBody struct {
@@ -43,7 +47,7 @@ type PreCreateBody struct {
 
 // PreCreate 预上传
 // @param localFilePath 上传后使用的文件绝对路径，需要 url encode
-func PreCreate(accessToken string, localFilePath string, prefixPath string, sequence int) (ret *PreCreateReturn, baiduFilePath string, blockList []string, fileSize int64, err error) {
+func (c *Client) PreCreate(ctx context.Context, localFilePath string, prefixPath string, sequence int) (ret *PreCreateReturn, baiduFilePath string, blockList []string, fileSize int64, err error) {
 	// 准备返回体，第一步
 	ret = &PreCreateReturn{}
 
@@ -57,24 +61,24 @@ func PreCreate(accessToken string, localFilePath string, prefixPath string, sequ
 	// 大文件分 20GB 小文件后预上传
 	if sequence != 0 {
 		// 计算当前要预上传的文件有多大
-		if int(fileSize/utils.MaxSingleFileSize) == sequence-1 {
+		if int(fileSize/c.MaxSingleFileSize) == sequence-1 {
 			// 这是最后一个文件，并且是不足 20GB 的文件，如果最后一个文件是 20GB 的话，没有这么大的 seq
-			fileSize = fileSize % utils.MaxSingleFileSize
+			fileSize = fileSize % c.MaxSingleFileSize
 		} else {
 			// 不是最后一个文件或者是最后一个文件且 20GB，所以文件大小一定是 20GB
-			fileSize = utils.MaxSingleFileSize
+			fileSize = c.MaxSingleFileSize
 		}
 
 		// 开始获取分块文件的 md5
-		blockList, err = utils.SliceFileNotSave(localFilePath, sequence, fileSize)
+		blockList, err = utils.SliceFileNotSave(ctx, localFilePath, sequence, fileSize, c.ChunkSize, c.MaxSingleFileSize)
 		if err != nil {
 			return
 		}
 	} else {
 		// 低于 20GB 文件预上传
-		if fileSize > utils.ChunkSize {
+		if fileSize > c.ChunkSize {
 			// 需要分块
-			blockList, err = utils.SliceFileNotSave(localFilePath, 0, 0)
+			blockList, err = utils.SliceFileNotSave(ctx, localFilePath, 0, 0, c.ChunkSize, c.MaxSingleFileSize)
 			if err != nil {
 				return
 			}
@@ -89,9 +93,9 @@ func PreCreate(accessToken string, localFilePath string, prefixPath string, sequ
 		}
 	}
 
-	client := http.Client{}
-	uri := "https://pan.baidu.com/rest/2.0/xpan/file?method=precreate&access_token=%s"
-	realUrl, _ := url.Parse(fmt.Sprintf(uri, accessToken))
+	params := url.Values{}
+	params.Set("method", "precreate")
+	realUrl := c.panURL("/rest/2.0/xpan/file", params)
 
 	// json body 参数
 	body := url.Values{}
@@ -118,26 +122,6 @@ func PreCreate(accessToken string, localFilePath string, prefixPath string, sequ
 	body.Add("autoinit", "1")
 	body.Add("rtype", "2")
 
-	header := http.Header{}
-	header.Set("Content-Type", "application/x-www-form-urlencoded")
-	header.Set("User-Agent", "pan.baidu.com")
-	req := &http.Request{
-		Method: "POST",
-		URL:    realUrl,
-		Header: header,
-		Body:   io.NopCloser(strings.NewReader(body.Encode())),
-	}
-
-	for i := 0; i < 3; i++ {
-		ret, err = utils.DoHttpRequest(ret, &client, req)
-		if err != nil {
-			continue
-		}
-		break
-	}
-
-	if ret.Errno != 0 {
-		return
-	}
+	err = postForm(ctx, c, "file/precreate", realUrl, body, ret)
 	return
 }
@@ -0,0 +1,156 @@
+package baidu_api
+
+import (
+	"baidu_tool/utils"
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	// minRateFactor 被限频后速率最低降到配置的多少
+	minRateFactor = 1.0 / 16
+	// rateRecoverInterval 多久没有再被限频，速率就翻倍恢复一次
+	rateRecoverInterval = 10 * time.Second
+)
+
+// RateLimiter 令牌桶限流器，被百度限频时自动降速，之后逐步恢复
+type RateLimiter struct {
+	mu sync.Mutex
+	// qps 配置的速率，不大于 0 时不限流
+	qps float64
+	// rate 当前速率，被限频后会低于 qps
+	rate     float64
+	tokens   float64
+	last     time.Time
+	lastSlow time.Time
+}
+
+// NewRateLimiter 创建每秒 qps 个请求的限流器，允许 qps 大小的突发，qps 不大于 0 时不限流
+func NewRateLimiter(qps float64) *RateLimiter {
+	return &RateLimiter{
+		qps:    qps,
+		rate:   qps,
+		tokens: burstOf(qps),
+	}
+}
+
+// burstOf 令牌桶容量，至少为 1
+func burstOf(rate float64) float64 {
+	return max(1, rate)
+}
+
+// Wait 等到可以发出一个请求，ctx 被取消时提前返回
+func (l *RateLimiter) Wait(ctx context.Context) error {
+	if l == nil {
+		return ctx.Err()
+	}
+	for {
+		l.mu.Lock()
+		if l.qps <= 0 {
+			l.mu.Unlock()
+			return ctx.Err()
+		}
+		l.refill(time.Now())
+		if l.tokens >= 1 {
+			l.tokens--
+			l.mu.Unlock()
+			return ctx.Err()
+		}
+		wait := time.Duration((1 - l.tokens) / l.rate * float64(time.Second))
+		l.mu.Unlock()
+		if err := sleepContext(ctx, wait); err != nil {
+			return err
+		}
+	}
+}
+
+// refill 按经过的时间补充令牌，并在一段时间没被限频后恢复速率，调用前需要持有锁
+func (l *RateLimiter) refill(now time.Time) {
+	if l.rate < l.qps && now.Sub(l.lastSlow) >= rateRecoverInterval {
+		l.rate = min(l.qps, l.rate*2)
+		l.lastSlow = now
+	}
+	if !l.last.IsZero() {
+		l.tokens = min(burstOf(l.rate), l.tokens+now.Sub(l.last).Seconds()*l.rate)
+	}
+	l.last = now
+}
+
+// SlowDown 被限频时调用，速率减半并清空令牌
+func (l *RateLimiter) SlowDown() {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.qps <= 0 {
+		return
+	}
+	l.rate = max(l.rate/2, l.qps*minRateFactor)
+	l.tokens = 0
+	l.lastSlow = time.Now()
+}
+
+// SetQPS 修改配置的速率，不大于 0 时不限流
+func (l *RateLimiter) SetQPS(qps float64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.qps = qps
+	l.rate = qps
+	l.tokens = min(l.tokens, burstOf(qps))
+}
+
+// QPS 配置的速率，不受限频后的降速影响
+func (l *RateLimiter) QPS() float64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.qps
+}
+
+// Rate 当前的速率
+func (l *RateLimiter) Rate() float64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.rate
+}
+
+// Limiters 按接口类别区分的限流器
+type Limiters struct {
+	// Metadata 列表、预上传、创建文件、下载地址这类元数据接口
+	Metadata *RateLimiter
+	// Upload 分片上传
+	Upload *RateLimiter
+	// Download 按 dlink 下载
+	Download *RateLimiter
+}
+
+// NewLimiters 创建一组限流器，qps 不大于 0 的类别不限流
+func NewLimiters(metadataQPS float64, uploadQPS float64, downloadQPS float64) *Limiters {
+	return &Limiters{
+		Metadata: NewRateLimiter(metadataQPS),
+		Upload:   NewRateLimiter(uploadQPS),
+		Download: NewRateLimiter(downloadQPS),
+	}
+}
+
+// 各类接口默认的每秒请求数
+const (
+	DefaultMetadataQPS = 5
+	DefaultUploadQPS   = 10
+	DefaultDownloadQPS = 10
+)
+
+// DefaultLimiters 整个进程共用的限流器，所有默认创建的 Client 都受它约束
+var DefaultLimiters = NewLimiters(DefaultMetadataQPS, DefaultUploadQPS, DefaultDownloadQPS)
+
+// isRateLimited 判断是否被限频：错误码 31034 或者 http 429
+func isRateLimited(err error) bool {
+	if errors.Is(err, ErrRateLimited) {
+		return true
+	}
+	var statusErr *utils.HTTPStatusError
+	return errors.As(err, &statusErr) && statusErr.StatusCode == http.StatusTooManyRequests
+}
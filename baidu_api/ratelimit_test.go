@@ -0,0 +1,76 @@
+package baidu_api_test
+
+import (
+	"baidu_tool/baidu_api"
+	"context"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestRateLimiterWaits(t *testing.T) {
+	limiter := baidu_api.NewRateLimiter(20)
+	ctx := context.Background()
+	start := time.Now()
+	// 前 20 个是突发，之后每个要等 50ms
+	for i := 0; i < 25; i++ {
+		if err := limiter.Wait(ctx); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if elapsed := time.Since(start); elapsed < 200*time.Millisecond {
+		t.Fatalf("25 requests at 20 qps finished too fast: %v", elapsed)
+	}
+}
+
+func TestRateLimiterSlowDown(t *testing.T) {
+	limiter := baidu_api.NewRateLimiter(16)
+	limiter.SlowDown()
+	if rate := limiter.Rate(); rate != 8 {
+		t.Fatalf("expected rate halved to 8, got %v", rate)
+	}
+	if qps := limiter.QPS(); qps != 16 {
+		t.Fatalf("configured qps should stay 16, got %v", qps)
+	}
+	for i := 0; i < 10; i++ {
+		limiter.SlowDown()
+	}
+	if rate := limiter.Rate(); rate != 1 {
+		t.Fatalf("expected rate floored at 1, got %v", rate)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := limiter.Wait(ctx); err == nil {
+		t.Fatal("expected Wait to fail on cancelled context")
+	}
+}
+
+func TestRateLimitedResponsesSlowDown(t *testing.T) {
+	server, client := newTestClient(t)
+	client.Retry = baidu_api.RetryPolicy{MaxAttempts: 3}
+	client.Limiters = baidu_api.NewLimiters(1000, 1000, 1000)
+	server.Mkdir("/apps/tool")
+
+	server.Fail("list", 1, 0, 31034)
+	if _, err := client.GetDirByList(context.Background(), "/apps/tool"); err != nil {
+		t.Fatal(err)
+	}
+	if rate := client.Limiters.Metadata.Rate(); rate != 500 {
+		t.Fatalf("metadata limiter should slow down after errno 31034, rate %v", rate)
+	}
+
+	server.PutFile("/apps/tool/a.txt", []byte("content"))
+	server.Fail("download", 1, http.StatusTooManyRequests, 0)
+	chdir(t, t.TempDir())
+	dirResp, err := client.GetDirByList(context.Background(), "/apps/tool")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = client.DownloadFileOrDir(context.Background(), dirResp.List, "/apps/tool"); err != nil {
+		t.Fatal(err)
+	}
+	if rate := client.Limiters.Download.Rate(); rate != 500 {
+		t.Fatalf("download limiter should slow down after http 429, rate %v", rate)
+	}
+}
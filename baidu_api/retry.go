@@ -0,0 +1,96 @@
+package baidu_api
+
+import (
+	"baidu_tool/utils"
+	"context"
+	"errors"
+	"log"
+	"math/rand"
+	"net/http"
+	"time"
+)
+
+// RetryPolicy 所有接口请求和下载分片共用的重试策略
+type RetryPolicy struct {
+	// MaxAttempts 最多尝试次数，包含第一次，小于 1 时按 1 处理
+	MaxAttempts int
+	// BaseDelay 第一次重试前的等待，之后每次翻倍
+	BaseDelay time.Duration
+	// MaxDelay 等待时间的上限
+	MaxDelay time.Duration
+}
+
+// DefaultRetryPolicy 默认重试策略
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts: 5,
+	BaseDelay:   time.Second,
+	MaxDelay:    30 * time.Second,
+}
+
+// Backoff 第 attempt 次失败后要等待的时间，指数增长，并在后一半范围内随机，避免大量协程同时重试
+func (p RetryPolicy) Backoff(attempt int) time.Duration {
+	if p.BaseDelay <= 0 || attempt < 1 {
+		return 0
+	}
+	delay := p.BaseDelay
+	for i := 1; i < attempt && (p.MaxDelay <= 0 || delay < p.MaxDelay); i++ {
+		delay *= 2
+	}
+	if p.MaxDelay > 0 && delay > p.MaxDelay {
+		delay = p.MaxDelay
+	}
+	half := delay / 2
+	return half + time.Duration(rand.Int63n(int64(half)+1))
+}
+
+// Do 按策略执行 fn，只有可重试的错误才会重试，返回最后一次的错误，ctx 被取消时不再重试
+func (p RetryPolicy) Do(ctx context.Context, fn func() error) error {
+	maxAttempts := max(p.MaxAttempts, 1)
+	var err error
+	for attempt := 1; ; attempt++ {
+		if err = ctx.Err(); err != nil {
+			return err
+		}
+		if err = fn(); err == nil {
+			return nil
+		}
+		if attempt >= maxAttempts || !IsRetryable(err) || ctx.Err() != nil {
+			return err
+		}
+		delay := p.Backoff(attempt)
+		log.Printf("第 %d 次请求失败，%v 后重试: %v\n", attempt, delay, err)
+		if sleepErr := sleepContext(ctx, delay); sleepErr != nil {
+			return err
+		}
+	}
+}
+
+// IsRetryable 判断错误是否值得重试：网络错误、429 和 5xx 状态码、限频错误码、过期的下载地址可以重试，其余的接口错误和授权错误重试也没用
+func IsRetryable(err error) bool {
+	if err == nil {
+		return false
+	}
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	// 过期的下载地址会在下一次尝试时换成新的
+	if errors.Is(err, ErrDLinkExpired) {
+		return true
+	}
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		return errors.Is(apiErr, ErrRateLimited)
+	}
+	var oauthErr *OAuthError
+	if errors.As(err, &oauthErr) {
+		return false
+	}
+	var statusErr *utils.HTTPStatusError
+	if errors.As(err, &statusErr) {
+		return statusErr.StatusCode == http.StatusTooManyRequests ||
+			statusErr.StatusCode == http.StatusRequestTimeout ||
+			statusErr.StatusCode >= 500
+	}
+	// 剩下的是网络连接、读取返回、解析返回这类错误
+	return true
+}
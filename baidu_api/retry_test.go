@@ -0,0 +1,109 @@
+package baidu_api_test
+
+import (
+	"baidu_tool/baidu_api"
+	"baidu_tool/utils"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestBackoffGrowsAndCaps(t *testing.T) {
+	policy := baidu_api.RetryPolicy{MaxAttempts: 10, BaseDelay: 100 * time.Millisecond, MaxDelay: time.Second}
+	for attempt, want := range map[int]time.Duration{1: 100 * time.Millisecond, 2: 200 * time.Millisecond, 3: 400 * time.Millisecond, 8: time.Second} {
+		for i := 0; i < 20; i++ {
+			got := policy.Backoff(attempt)
+			if got < want/2 || got > want {
+				t.Fatalf("attempt %d: backoff %v out of [%v, %v]", attempt, got, want/2, want)
+			}
+		}
+	}
+}
+
+func TestIsRetryable(t *testing.T) {
+	cases := []struct {
+		err  error
+		want bool
+	}{
+		{&utils.HTTPStatusError{StatusCode: http.StatusServiceUnavailable}, true},
+		{&utils.HTTPStatusError{StatusCode: http.StatusTooManyRequests}, true},
+		{&utils.HTTPStatusError{StatusCode: http.StatusForbidden}, false},
+		{&baidu_api.APIError{Errno: 31034}, true},
+		{&baidu_api.APIError{Errno: -9}, false},
+		{io.ErrUnexpectedEOF, true},
+	}
+	for _, c := range cases {
+		if got := baidu_api.IsRetryable(c.err); got != c.want {
+			t.Errorf("IsRetryable(%v) = %v, want %v", c.err, got, c.want)
+		}
+	}
+}
+
+func TestRetryPolicyDo(t *testing.T) {
+	policy := baidu_api.RetryPolicy{MaxAttempts: 3}
+	calls := 0
+	err := policy.Do(context.Background(), func() error {
+		calls++
+		return &utils.HTTPStatusError{StatusCode: http.StatusBadGateway}
+	})
+	if calls != 3 || err == nil {
+		t.Fatalf("expected 3 attempts and an error, got %d attempts, %v", calls, err)
+	}
+
+	calls = 0
+	err = policy.Do(context.Background(), func() error {
+		calls++
+		return &baidu_api.APIError{Errno: -9}
+	})
+	if calls != 1 || !errors.Is(err, baidu_api.ErrPathNotFound) {
+		t.Fatalf("non-retryable error should not be retried, got %d attempts, %v", calls, err)
+	}
+}
+
+func TestRequestsAreRetried(t *testing.T) {
+	server, client := newTestClient(t)
+	client.Retry = baidu_api.RetryPolicy{MaxAttempts: 3}
+	server.Mkdir("/apps/tool")
+
+	server.Fail("list", 2, 0, 31034)
+	if _, err := client.GetDirByList(context.Background(), "/apps/tool"); err != nil {
+		t.Fatalf("rate limited list should succeed after retries: %v", err)
+	}
+	if n := server.Requests("list"); n != 3 {
+		t.Fatalf("expected 3 list requests, got %d", n)
+	}
+
+	server.Fail("list", 3, http.StatusInternalServerError, 0)
+	if _, err := client.GetDirByList(context.Background(), "/apps/tool"); err == nil {
+		t.Fatal("expected error after exhausting attempts")
+	}
+}
+
+func TestDownloadRetriesFailedRange(t *testing.T) {
+	server, client := newTestClient(t)
+	client.Retry = baidu_api.RetryPolicy{MaxAttempts: 3}
+	chdir(t, t.TempDir())
+	server.PutFile("/apps/tool/a.txt", []byte("content"))
+
+	server.Fail("download", 2, http.StatusServiceUnavailable, 0)
+	dirResp, err := client.GetDirByList(context.Background(), "/apps/tool")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = client.DownloadFileOrDir(context.Background(), dirResp.List, "/apps/tool"); err != nil {
+		t.Fatalf("download should succeed after retries: %v", err)
+	}
+
+	server.PutFile("/apps/tool/b.txt", []byte("more"))
+	server.Fail("download", 3, http.StatusServiceUnavailable, 0)
+	dirResp, err = client.GetDirByList(context.Background(), "/apps/tool")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = client.DownloadFileOrDir(context.Background(), dirResp.List, "/apps/tool"); err == nil {
+		t.Fatal("expected download error after exhausting attempts")
+	}
+}
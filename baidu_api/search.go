@@ -0,0 +1,77 @@
+package baidu_api
+
+import (
+	"context"
+	"net/url"
+	"strconv"
+)
+
+// defaultSearchPageSize search 接口每页默认的数量
+const defaultSearchPageSize = 500
+
+// SearchResp 搜索接口返回
+type SearchResp struct {
+	Errno     int          `json:"errno"`
+	Errmsg    string       `json:"errmsg"`
+	List      []*FileOrDir `json:"list"`
+	HasMore   int8         `json:"has_more"`
+	RequestID RequestID    `json:"request_id"`
+}
+
+func (r *SearchResp) apiError(endpoint string) error {
+	return checkErrno(endpoint, r.Errno, r.Errmsg, r.RequestID)
+}
+
+// SearchOptions 搜索的范围
+type SearchOptions struct {
+	// Dir 在哪个文件夹下搜索，为空时是根目录
+	Dir string
+	// Recursion 是否搜索所有层级的下级
+	Recursion bool
+	// Category 文件类型，1 视频 2 音频 3 图片 4 文档 5 应用 6 其他 7 种子，0 为不限制
+	Category int
+	// PageSize 每页多少个，不大于 0 时为 500
+	PageSize int
+}
+
+// SearchPage 按文件名关键词搜索，page 从 1 开始
+func (c *Client) SearchPage(ctx context.Context, key string, opts SearchOptions, page int) (*SearchResp, error) {
+	pageSize := opts.PageSize
+	if pageSize <= 0 {
+		pageSize = defaultSearchPageSize
+	}
+	params := url.Values{}
+	params.Set("method", "search")
+	params.Set("key", key)
+	if opts.Dir != "" {
+		params.Set("dir", opts.Dir)
+	}
+	if opts.Recursion {
+		params.Set("recursion", "1")
+	}
+	if opts.Category > 0 {
+		params.Set("category", strconv.Itoa(opts.Category))
+	}
+	params.Set("page", strconv.Itoa(page))
+	params.Set("num", strconv.Itoa(pageSize))
+	var searchResp SearchResp
+	if err := getJSON(ctx, c, "file/search", c.panURL("/rest/2.0/xpan/file", params), &searchResp); err != nil {
+		return nil, err
+	}
+	return &searchResp, nil
+}
+
+// Search 在网盘中按文件名关键词搜索，自动翻页直到取完，结果可以直接交给 DownloadFileOrDir 下载
+func (c *Client) Search(ctx context.Context, key string, opts SearchOptions) ([]*FileOrDir, error) {
+	var list []*FileOrDir
+	for page := 1; ; page++ {
+		searchResp, err := c.SearchPage(ctx, key, opts, page)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, searchResp.List...)
+		if searchResp.HasMore != 1 || len(searchResp.List) == 0 {
+			return list, nil
+		}
+	}
+}
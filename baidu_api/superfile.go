@@ -0,0 +1,67 @@
+package baidu_api
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"strconv"
+)
+
+type SingleUploadReturn struct {
+	Md5       string    `json:"md5"`
+	ErrorCode int       `json:"error_code"`
+	ErrorMsg  string    `json:"error_msg"`
+	RequestId RequestID `json:"request_id"`
+}
+
+func (r *SingleUploadReturn) apiError(endpoint string) error {
+	return checkErrno(endpoint, r.ErrorCode, r.ErrorMsg, r.RequestId)
+}
+
+func (c *Client) SingleUpload(ctx context.Context, uploadId string, baiduFilePath string, FileBytes []byte, partSeq int) (*SingleUploadReturn, error) {
+	ret := new(SingleUploadReturn)
+
+	payload := &bytes.Buffer{}
+	bodyWriter := multipart.NewWriter(payload)
+	fileWriter, err := bodyWriter.CreateFormFile("file", "file")
+	if err != nil {
+		return ret, err
+	}
+	_, err = io.Copy(fileWriter, bytes.NewReader(FileBytes))
+	if err != nil {
+		return ret, err
+	}
+	if err = bodyWriter.Close(); err != nil {
+		return nil, err
+	}
+	contentType := bodyWriter.FormDataContentType()
+
+	params := url.Values{}
+	params.Set("method", "upload")
+	params.Set("path", baiduFilePath)
+	params.Set("uploadid", uploadId)
+	params.Set("partseq", strconv.Itoa(partSeq))
+	uri := c.pcsURL("/rest/2.0/pcs/superfile2", params)
+
+	bts := payload.Bytes()
+	err = doRequest(ctx, c, c.uploadLimiter(), "superfile2/upload", func() (*http.Request, error) {
+		// 每次重试都重新构建请求体
+		req, err := c.newRequest(ctx, "POST", uri, bytes.NewReader(bts))
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Content-Type", contentType)
+		return req, nil
+	}, ret)
+	if err != nil {
+		return ret, err
+	}
+	if ret.Md5 == "" {
+		return ret, errors.New("md5 is empty")
+	}
+	return ret, nil
+}
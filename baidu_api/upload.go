@@ -1,235 +1,290 @@
 package baidu_api
 
 import (
-	"baidu_tool/upload"
 	"baidu_tool/utils"
+	"context"
+	"errors"
 	"fmt"
 	"github.com/vbauerster/mpb"
 	"github.com/vbauerster/mpb/decor"
 	"log"
-	"math/rand"
 	"os"
-	"runtime"
 	"slices"
 	"strconv"
 	"strings"
 	"sync"
-	"time"
+	"sync/atomic"
 )
 
 type FileInfo struct {
-	PreCreateReturn     *upload.PreCreateReturn
+	PreCreateReturn     *PreCreateReturn
+	LocalFilePath       string
 	BaiduFilePath       string
 	BlockList           []string
 	FileSize            int64
 	SlicedFileBytesChan chan *utils.SlicedFileByte
 	Bar                 *mpb.Bar
+	// uploaded 已上传的字节数，多个分片协程同时累加
+	uploaded atomic.Int64
+}
+
+// event 这个文件的传输事件
+func (f *FileInfo) event(eventType string) TransferEvent {
+	return TransferEvent{
+		Type:        eventType,
+		Op:          OpUpload,
+		Path:        f.BaiduFilePath,
+		LocalPath:   f.LocalFilePath,
+		Size:        f.FileSize,
+		Transferred: f.uploaded.Load(),
+	}
 }
 
 // UploadFileOrDir 上传文件或者文件夹
+// 任何一个文件出错或者 ctx 被取消时，所有协程都会停下，等它们都退出后才返回，调用方可以放心做清理
 // @param localFilePath 要上传的文件或文件夹的相对位置或绝对位置
 // @param baiduPrefixPath 上传后在网盘内的 我的应用数据/baiduPrefixPath/localFilePath 如果没传就在 我的应用数据/localFilePath
-func UploadFileOrDir(accessToken string, localFilePaths []string, baiduPrefixPath string, progress *mpb.Progress) error {
+func (c *Client) UploadFileOrDir(ctx context.Context, localFilePaths []string, baiduPrefixPath string, progress *mpb.Progress) error {
+	// 使用了多个协程在高层逻辑，出现错误时用 cancel 让大家都停下
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	var uploadErr error
+	uploadErrOnce := &sync.Once{}
+	fail := func(err error) {
+		uploadErrOnce.Do(func() {
+			log.Printf("%v\n", err)
+			uploadErr = err
+			cancel()
+		})
+	}
+	// 所有协程都登记在这里，返回前要等它们都退出
+	workerWG := &sync.WaitGroup{}
+
 	// 上传过程，再次切文件，但这次最多同时保留进程数量的 字节段 在内存中（不需要保存文件）
-	maxConcurrentCount := min(16, runtime.NumCPU())
+	maxConcurrentCount := c.MaxConcurrent
 	// 该信道控制上传协程并发量
 	limitChan := make(chan struct{}, maxConcurrentCount)
-	defer close(limitChan)
 	// 该信道控制上传文件信息
 	uploadFileInfoChan := make(chan *FileInfo)
 	// 该信道控制创建文件信息
 	createFileInfoChan := make(chan *FileInfo)
 
-	// 使用了多个协程在高层逻辑，需要一个信号来关闭大家当 panic 级别错误出现或结束
-	closeChan := make(chan struct{})
+	// 预上传一个文件，完成后推送给上传信道，并开始传输切片，调用前需要占用一个并行量
+	preCreate := func(localFilePath string, sequence int, preCreateWG *sync.WaitGroup) {
+		defer workerWG.Done()
+		tempFileInfo := &FileInfo{LocalFilePath: localFilePath}
+		var err error
+		tempFileInfo.PreCreateReturn, tempFileInfo.BaiduFilePath, tempFileInfo.BlockList, tempFileInfo.FileSize, err = c.PreCreate(ctx, localFilePath, baiduPrefixPath, sequence)
+		// 预上传部分占用并行数量必须在 影响上传部分 之前释放
+		<-limitChan
+		if err != nil {
+			preCreateWG.Done()
+			if ctx.Err() == nil {
+				c.emitFailed(tempFileInfo.event(EventFailed), err)
+			}
+			fail(err)
+			return
+		}
+
+		// 预上传接口调用成功后，这个文件接下来会被开始上传，与此同时就该启动 文件切片传输字节信道 来呼应接下来的上传
+		tempFileInfo.SlicedFileBytesChan = make(chan *utils.SlicedFileByte)
+		// 当前该文件信息已经完成好上传前所有准备工作，可以推送给上传文件信道
+		select {
+		case uploadFileInfoChan <- tempFileInfo:
+			preCreateWG.Done()
+		case <-ctx.Done():
+			preCreateWG.Done()
+			return
+		}
+		// 推送到上传信道好后，可以开始传输切片
+		if err = utils.SliceFilePushToChan(ctx, localFilePath, tempFileInfo.SlicedFileBytesChan, sequence, tempFileInfo.FileSize, c.ChunkSize, c.MaxSingleFileSize); err != nil && ctx.Err() == nil {
+			fail(err)
+		}
+	}
 
 	// 做预创建文件的协程
+	workerWG.Add(1)
 	go func() {
+		defer workerWG.Done()
 		// 使用协程进行对多个文件并行预上传
 		preCreateWG := &sync.WaitGroup{}
+		defer func() {
+			preCreateWG.Wait()
+			// 需要往 uploadChannel 输送的数据已经输送好了，可以关闭 uploadChannel
+			close(uploadFileInfoChan)
+		}()
 		for _, localFilePath := range localFilePaths {
-			// 对于一个本地文件，至少要预上传一个文件
-			preCreateWG.Add(1)
-
 			// 第一步，检查文件是否超过 20GB
 			fileInfo, err := os.Stat(localFilePath)
 			if err != nil {
-				close(closeChan)
+				fail(err)
 				return
 			}
 			fileSize := fileInfo.Size()
-			// 超级会员单文件限制
-			if fileSize > utils.MaxSingleFileSize {
+			// 超级会员单文件限制，不超过时作为序号 0 的单文件上传
+			sequences := []int{0}
+			if fileSize > c.MaxSingleFileSize {
 				// 分成的文件数量
 				var fileNum int
-				if fileSize%utils.MaxSingleFileSize != 0 {
+				if fileSize%c.MaxSingleFileSize != 0 {
 					// 无法整除，就会有最后一个不足 20GB 的文件
 					fileNum = 1
 				}
-				fileNum += int(fileSize / utils.MaxSingleFileSize)
-				// 比预期的单文件要额外多预上传 fileNum - 1 个文件
-				preCreateWG.Add(fileNum - 1)
+				fileNum += int(fileSize / c.MaxSingleFileSize)
 
 				// 如果是要分割的大文件，先看多少小文件已经上传好了
-				uploadedSlicedSeqList, err := SearchUploadedSlicedFileSeqList(accessToken, localFilePath, baiduPrefixPath)
+				uploadedSlicedSeqList, err := c.SearchUploadedSlicedFileSeqList(ctx, localFilePath, baiduPrefixPath)
 				if err != nil {
-					fmt.Printf("SearchUplaodSliecdFileSeqList err %v", err)
+					fail(fmt.Errorf("SearchUploadedSlicedFileSeqList err: %w", err))
 					return
 				}
+				sequences = nil
 				for i := 1; i <= fileNum; i++ {
 					// 若切割文件已存在，可以直接跳过
-					if slices.Contains(uploadedSlicedSeqList, i) {
-						preCreateWG.Done()
-						continue
+					if !slices.Contains(uploadedSlicedSeqList, i) {
+						sequences = append(sequences, i)
 					}
-					// 准备开始预上传，需要网络
-					limitChan <- struct{}{}
-					time.Sleep(time.Second + time.Millisecond*time.Duration(rand.Intn(100)))
-					go func(index int, bigLocalFilePath string) {
-						var tempFileInfo FileInfo
-						tempFileInfo.PreCreateReturn, tempFileInfo.BaiduFilePath, tempFileInfo.BlockList, tempFileInfo.FileSize, err = upload.PreCreate(accessToken, bigLocalFilePath, baiduPrefixPath, index)
-						if err != nil {
-							log.Printf("%v\n", err)
-							close(closeChan)
-							return
-						}
-
-						// 预上传接口调用成功后，这个文件接下来会被开始上传，与此同时就该启动 文件切片传输字节信道 来呼应接下来的上传
-						tempFileInfo.SlicedFileBytesChan = make(chan *utils.SlicedFileByte)
-						// 预上传部分占用并行数量必须在 影响上传部分 之前释放
-						<-limitChan
-						// 当前该文件信息已经完成好上传前所有准备工作，可以推送给上传文件信道
-						uploadFileInfoChan <- &tempFileInfo
-						preCreateWG.Done()
-						// 释放一个并行量
-						// 推送到上传信道好后，可以开始传输切片
-						if err = utils.SliceFilePushToChan(bigLocalFilePath, tempFileInfo.SlicedFileBytesChan, index, tempFileInfo.FileSize); err != nil {
-							log.Printf("sliceFilePushToChan err: %v", err)
-							close(closeChan)
-						}
-					}(i, localFilePath)
 				}
-			} else {
-				// 单文件开始预上传
-				limitChan <- struct{}{}
-				go func(singleLocalFilePath string) {
-					var preFileInfo FileInfo
-					preFileInfo.PreCreateReturn, preFileInfo.BaiduFilePath, preFileInfo.BlockList, preFileInfo.FileSize, err = upload.PreCreate(accessToken, singleLocalFilePath, baiduPrefixPath, 0)
-					if err != nil {
-						log.Printf("%v\n", err)
-						close(closeChan)
-						return
-					}
-					preFileInfo.SlicedFileBytesChan = make(chan *utils.SlicedFileByte)
-					// 预上传部分占用并行数量必须在 影响上传部分 之前释放
-					<-limitChan
-					uploadFileInfoChan <- &preFileInfo
-					preCreateWG.Done()
-					if err := utils.SliceFilePushToChan(singleLocalFilePath, preFileInfo.SlicedFileBytesChan, 0, 0); err != nil {
-						log.Printf("err: %+v", err)
-						close(closeChan)
-					}
-				}(localFilePath)
+			}
+			for _, sequence := range sequences {
+				// 准备开始预上传，需要网络
+				if err = acquire(ctx, limitChan); err != nil {
+					return
+				}
+				preCreateWG.Add(1)
+				workerWG.Add(1)
+				go preCreate(localFilePath, sequence, preCreateWG)
 			}
 		}
-		preCreateWG.Wait()
-		// 需要往 uploadChannel 输送的数据已经输送好了，可以关闭 uploadChannel
-		close(uploadFileInfoChan)
 	}()
 
 	// 做上传碎片文件的协程
+	workerWG.Add(1)
 	go func() {
+		defer workerWG.Done()
 		// 上传步骤为主要步骤，要控制文件上传的顺序，避免第一个碎片文件和最后一个碎片文件直接间隔太长
 		uploadLimitChan := make(chan struct{}, 2)
 		// 所有上传文件的 wg
 		uploadWG := &sync.WaitGroup{}
+		defer func() {
+			// 等自己要 upload 的事情做完就可以关闭 create 信道
+			uploadWG.Wait()
+			close(createFileInfoChan)
+		}()
 		for {
+			var uploadFileInfo *FileInfo
+			var ok bool
 			select {
-			case <-closeChan:
+			case <-ctx.Done():
+				return
+			case uploadFileInfo, ok = <-uploadFileInfoChan:
+			}
+			if !ok {
+				// upload 信道已关闭
 				return
-			case uploadFileInfo, ok := <-uploadFileInfoChan:
-				if !ok {
-					// upload 信道已关闭，等自己要 upload 的事情做完就可以关闭 create 信道
-					uploadWG.Wait()
-					close(createFileInfoChan)
+			}
+			// 为该文件争取到并发量
+			if err := acquire(ctx, uploadLimitChan); err != nil {
+				return
+			}
+			// 多一个要上传的文件
+			uploadWG.Add(1)
+			// 上传开启，新建一个进度条
+			uploadFileInfo.Bar = progress.AddBar(
+				uploadFileInfo.FileSize,
+				mpb.PrependDecorators(decor.Name(uploadFileInfo.BaiduFilePath), decor.Percentage(decor.WCSyncSpace)),
+				mpb.BarRemoveOnComplete(),
+			)
+			c.emit(uploadFileInfo.event(EventStarted))
+			go func(fileInfo *FileInfo) {
+				// 一个整文件的完成
+				defer uploadWG.Done()
+				defer func() {
+					<-uploadLimitChan
+				}()
+				// 该文件的碎片上传 wg 同步控制，
+				slicedUploadWaitGroup := &sync.WaitGroup{}
+				for slicedFileByte := range fileInfo.SlicedFileBytesChan {
+					if err := acquire(ctx, limitChan); err != nil {
+						break
+					}
+					slicedUploadWaitGroup.Add(1)
+					go func(fileBytes *utils.SlicedFileByte, smallFileInfo *FileInfo) {
+						defer slicedUploadWaitGroup.Done()
+						_, err := c.SingleUpload(ctx, smallFileInfo.PreCreateReturn.UploadId, smallFileInfo.BaiduFilePath, fileBytes.Bytes, fileBytes.Index)
+						<-limitChan
+						if err != nil {
+							if ctx.Err() == nil {
+								c.emitFailed(smallFileInfo.event(EventFailed), err)
+							}
+							fail(err)
+							return
+						}
+						smallFileInfo.Bar.IncrBy(len(fileBytes.Bytes))
+						smallFileInfo.uploaded.Add(int64(len(fileBytes.Bytes)))
+						c.emit(smallFileInfo.event(EventProgress))
+					}(slicedFileByte, fileInfo)
+				}
+				slicedUploadWaitGroup.Wait()
+				if ctx.Err() != nil {
+					progress.Abort(fileInfo.Bar, false)
 					return
 				}
-				// 多一个要上传的文件
-				uploadWG.Add(1)
-				// 为该文件争取到并发量
-				uploadLimitChan <- struct{}{}
-				// 上传开启，新建一个进度条
-				uploadFileInfo.Bar = progress.AddBar(
-					uploadFileInfo.FileSize,
-					mpb.PrependDecorators(decor.Name(uploadFileInfo.BaiduFilePath), decor.Percentage(decor.WCSyncSpace)),
-					mpb.BarRemoveOnComplete(),
-				)
-				go func(fileInfo *FileInfo) {
-					// 该文件的碎片上传 wg 同步控制，
-					slicedUploadWaitGroup := &sync.WaitGroup{}
-					for slicedFileByte := range fileInfo.SlicedFileBytesChan {
-						limitChan <- struct{}{}
-						time.Sleep(time.Second + time.Millisecond*time.Duration(rand.Intn(100)))
-						slicedUploadWaitGroup.Add(1)
-						go func(fileBytes *utils.SlicedFileByte, smallFileInfo *FileInfo) {
-							if _, err := upload.SingleUpload(accessToken, smallFileInfo.PreCreateReturn.UploadId, smallFileInfo.BaiduFilePath, fileBytes.Bytes, fileBytes.Index); err != nil {
-								close(closeChan)
-								return
-							}
-							<-limitChan
-							smallFileInfo.Bar.IncrBy(int(utils.ChunkSize))
-							slicedUploadWaitGroup.Done()
-						}(slicedFileByte, fileInfo)
-					}
-					slicedUploadWaitGroup.Wait()
-					// 文件的上传过程完成，推送信息到最后的创建文件信道
-					createFileInfoChan <- fileInfo
-					// 一个整文件的完成
-					uploadWG.Done()
-					<-uploadLimitChan
-				}(uploadFileInfo)
-			}
+				// 文件的上传过程完成，推送信息到最后的创建文件信道
+				select {
+				case createFileInfoChan <- fileInfo:
+				case <-ctx.Done():
+				}
+			}(uploadFileInfo)
 		}
 	}()
 
 	// 做收尾创建文件的协程
+	workerWG.Add(1)
 	go func() {
+		defer workerWG.Done()
 		createWG := &sync.WaitGroup{}
+		// 等最后一个文件创建完毕后，就可以全局结束
+		defer createWG.Wait()
 		for {
+			var createFileInfo *FileInfo
+			var ok bool
 			select {
-			case <-closeChan:
+			case <-ctx.Done():
+				return
+			case createFileInfo, ok = <-createFileInfoChan:
+			}
+			if !ok {
+				// 已经没有新的要创建的文件了
+				return
+			}
+			if err := acquire(ctx, limitChan); err != nil {
 				return
-			case createFileInfo, ok := <-createFileInfoChan:
-				if !ok {
-					// 已经没有新的要创建的文件了
-					// 等最后一个文件创建完毕后，就可以全局关闭
-					createWG.Wait()
-					close(closeChan)
+			}
+			createWG.Add(1)
+			go func(fileInfo *FileInfo) {
+				// 创建完表示一个文件处理完毕
+				defer createWG.Done()
+				_, err := c.Create(ctx, fileInfo.BaiduFilePath, fileInfo.FileSize, fileInfo.BlockList, fileInfo.PreCreateReturn.UploadId)
+				<-limitChan
+				if err != nil {
+					if ctx.Err() == nil {
+						c.emitFailed(fileInfo.event(EventFailed), err)
+					}
+					fail(err)
 					return
 				}
-				createWG.Add(1)
-				limitChan <- struct{}{}
-				time.Sleep(time.Second + time.Millisecond*time.Duration(rand.Intn(100)))
-				go func(fileInfo *FileInfo) {
-					_, err := upload.Create(accessToken, fileInfo.BaiduFilePath, fileInfo.FileSize, fileInfo.BlockList, fileInfo.PreCreateReturn.UploadId)
-					if err != nil {
-						log.Printf("err: %v\n", err)
-						close(closeChan)
-					}
-					<-limitChan
-					// 创建完表示一个文件处理完毕
-					createWG.Done()
-				}(createFileInfo)
-			}
+				c.emit(fileInfo.event(EventCompleted))
+			}(createFileInfo)
 		}
 	}()
 
 	// 同步收尾
-	select {
-	case <-closeChan:
-		// END
+	workerWG.Wait()
+	if uploadErr != nil {
+		return uploadErr
 	}
-	return nil
+	return ctx.Err()
 }
 
 // ParseBaiduPrefixPath 处理传入的百度前缀地址，去除首尾可能存在的 '/'
@@ -247,7 +302,8 @@ func ParseBaiduPrefixPath(baiduPrefixPath string) string {
 	return baiduPrefixPath
 }
 
-func SearchUploadedSlicedFileSeqList(accessToken string, localFilePath string, prefixPath string) ([]int, error) {
+// SearchUploadedSlicedFileSeqList 找出超大文件已经上传好的分割文件序号
+func (c *Client) SearchUploadedSlicedFileSeqList(ctx context.Context, localFilePath string, prefixPath string) ([]int, error) {
 	baiduPathBuilder := strings.Builder{}
 	baiduPathBuilder.WriteString("/apps")
 	if prefixPath != "" {
@@ -257,9 +313,9 @@ func SearchUploadedSlicedFileSeqList(accessToken string, localFilePath string, p
 	baiduPathBuilder.WriteString("/")
 	baiduPathBuilder.WriteString(localFilePath)
 	baiduPath := baiduPathBuilder.String()
-	resp, err := GetDirByList(accessToken, baiduPath)
+	resp, err := c.GetDirByList(ctx, baiduPath)
 	if err != nil {
-		if err.Error() == "NOT_FOUND" {
+		if errors.Is(err, ErrPathNotFound) {
 			return nil, nil
 		}
 		return nil, err
@@ -0,0 +1,62 @@
+package baidu_api
+
+import (
+	"baidu_tool/utils"
+	"errors"
+	"os"
+	"strings"
+)
+
+// ErrChecksumMismatch 本地文件内容的 md5 和网盘记录的不一致
+var ErrChecksumMismatch = errors.New("checksum mismatch")
+
+// 本地文件和网盘文件的核对结果
+const (
+	// VerifyOK 大小和 md5 都一致
+	VerifyOK = "ok"
+	// VerifySizeOnly 网盘的 md5 不可靠，只核对了大小
+	VerifySizeOnly = "size_only"
+	// VerifyMismatch 大小或 md5 不一致
+	VerifyMismatch = "mismatch"
+	// VerifyMissing 本地没有这个文件
+	VerifyMissing = "missing"
+)
+
+// ReliableMD5 网盘记录的 md5 能不能用来核对内容
+// 只有一个分块上传的文件记录的是内容的 md5，分块上传的大文件和部分接口返回的混淆过的 md5 都对不上
+// 网盘返回了 block_list 时按分块数判断，没有返回时按百度固定的 4MB 上传分块判断，不超过 4MB 的文件一定只有一块
+func ReliableMD5(md5 string, size int64, blockList []string) bool {
+	if len(md5) != 32 || strings.Trim(strings.ToLower(md5), "0123456789abcdef") != "" {
+		return false
+	}
+	if len(blockList) > 0 {
+		return len(blockList) == 1
+	}
+	return size <= utils.ChunkSize
+}
+
+// VerifyLocalFile 核对本地文件和网盘文件的大小，md5 可靠时再核对内容，返回 VerifyOK 等核对结果
+// blockList 是网盘返回的分块 md5 列表，没有时传 nil
+func VerifyLocalFile(localPath string, size int64, md5 string, blockList []string) (string, error) {
+	fileInfo, err := os.Stat(localPath)
+	if os.IsNotExist(err) {
+		return VerifyMissing, nil
+	}
+	if err != nil {
+		return "", err
+	}
+	if fileInfo.IsDir() || fileInfo.Size() != size {
+		return VerifyMismatch, nil
+	}
+	if !ReliableMD5(md5, size, blockList) {
+		return VerifySizeOnly, nil
+	}
+	localMD5, err := utils.FileToMd5(localPath)
+	if err != nil {
+		return "", err
+	}
+	if !strings.EqualFold(localMD5, md5) {
+		return VerifyMismatch, nil
+	}
+	return VerifyOK, nil
+}
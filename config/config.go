@@ -0,0 +1,146 @@
+package config
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/BurntSushi/toml"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// DefaultProfile 没有指定 profile 时使用的账号
+const DefaultProfile = "default"
+
+// EnvPrefix 环境变量前缀，参数 upload_qps 对应环境变量 BAIDU_TOOL_UPLOAD_QPS
+const EnvPrefix = "BAIDU_TOOL_"
+
+// File config.toml 的内容，键名和命令行参数同名。顶层是所有账号共用的设置，
+// 每个 profile 是一个账号，它的设置覆盖顶层的，如
+//
+//	default_profile = "work"
+//	concurrency = 8
+//
+//	[profiles.work]
+//	prefix = "project"
+//	upload_qps = 5
+type File struct {
+	DefaultProfile string
+	// Global 所有账号共用的设置
+	Global map[string]any
+	// Profiles 每个账号自己的设置
+	Profiles map[string]map[string]any
+}
+
+// DefaultConfigPath 默认的配置文件路径
+func DefaultConfigPath() (string, error) {
+	dir, err := DefaultDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "config.toml"), nil
+}
+
+// Load 读取配置文件，文件不存在时返回空配置
+func Load(configPath string) (*File, error) {
+	var raw map[string]any
+	_, err := toml.DecodeFile(configPath, &raw)
+	if errors.Is(err, os.ErrNotExist) {
+		return &File{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("parse %s: %w", configPath, err)
+	}
+	file := &File{Global: map[string]any{}, Profiles: map[string]map[string]any{}}
+	for key, value := range raw {
+		switch key {
+		case "default_profile":
+			name, ok := value.(string)
+			if !ok {
+				return nil, fmt.Errorf("parse %s: default_profile must be a string", configPath)
+			}
+			file.DefaultProfile = name
+		case "profiles":
+			profiles, ok := value.(map[string]any)
+			if !ok {
+				return nil, fmt.Errorf("parse %s: profiles must be tables", configPath)
+			}
+			for name, settings := range profiles {
+				if file.Profiles[name], ok = settings.(map[string]any); !ok {
+					return nil, fmt.Errorf("parse %s: profile %s must be a table", configPath, name)
+				}
+			}
+		default:
+			file.Global[key] = value
+		}
+	}
+	return file, nil
+}
+
+// ProfileName 决定使用哪个 profile：指定的 > 配置文件中的 default_profile > default
+func (f *File) ProfileName(name string) string {
+	if name != "" {
+		return name
+	}
+	if f.DefaultProfile != "" {
+		return f.DefaultProfile
+	}
+	return DefaultProfile
+}
+
+// Profile 某个 profile 的设置，default 没有配置时返回空设置，其他不存在的 profile 返回错误
+func (f *File) Profile(name string) (map[string]any, error) {
+	if settings, ok := f.Profiles[name]; ok {
+		return settings, nil
+	}
+	if name == DefaultProfile {
+		return nil, nil
+	}
+	return nil, fmt.Errorf("profile %q not found in config", name)
+}
+
+// Apply 把 settings 中的值设置到 flagSet 上，已经设置过的参数不会被覆盖，
+// 所以按优先级从高到低依次 Apply 即可叠加多层设置。
+// 不认识的键会被忽略，方便同一份设置供不同的命令使用
+func Apply(flagSet *flag.FlagSet, settings map[string]any) error {
+	explicit := map[string]bool{}
+	flagSet.Visit(func(f *flag.Flag) {
+		explicit[f.Name] = true
+	})
+	keys := make([]string, 0, len(settings))
+	for key := range settings {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		if explicit[key] || flagSet.Lookup(key) == nil {
+			continue
+		}
+		if err := flagSet.Set(key, fmt.Sprint(settings[key])); err != nil {
+			return fmt.Errorf("setting %s: %w", key, err)
+		}
+	}
+	return nil
+}
+
+// Environ 从环境变量中找出 flagSet 中每个参数的设置
+func Environ(flagSet *flag.FlagSet) map[string]any {
+	settings := map[string]any{}
+	flagSet.VisitAll(func(f *flag.Flag) {
+		if value, ok := os.LookupEnv(EnvPrefix + strings.ToUpper(f.Name)); ok {
+			settings[f.Name] = value
+		}
+	})
+	return settings
+}
+
+// ProfileCredentialFile profile 对应的凭证文件，每个账号各存一份
+func ProfileCredentialFile(profile string) (*CredentialFile, error) {
+	dir, err := DefaultDir()
+	if err != nil {
+		return nil, err
+	}
+	return &CredentialFile{Path: filepath.Join(dir, "credentials", profile+".json")}, nil
+}
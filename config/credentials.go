@@ -0,0 +1,45 @@
+package config
+
+import (
+	"baidu_tool/baidu_api"
+	"baidu_tool/utils"
+	"encoding/json"
+	"os"
+	"path/filepath"
+)
+
+// DefaultDir 配置文件所在目录，一般是 ~/.config/baidu_tool
+func DefaultDir() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "baidu_tool"), nil
+}
+
+// CredentialFile 保存在本地的身份凭证文件，只有自己可读写
+type CredentialFile struct {
+	Path string
+}
+
+// Load 读取凭证，文件不存在时返回的错误满足 errors.Is(err, os.ErrNotExist)
+func (f *CredentialFile) Load() (*baidu_api.Credentials, error) {
+	bts, err := os.ReadFile(f.Path)
+	if err != nil {
+		return nil, err
+	}
+	var credentials baidu_api.Credentials
+	if err = json.Unmarshal(bts, &credentials); err != nil {
+		return nil, err
+	}
+	return &credentials, nil
+}
+
+// Save 保存凭证
+func (f *CredentialFile) Save(credentials *baidu_api.Credentials) error {
+	bts, err := json.MarshalIndent(credentials, "", "  ")
+	if err != nil {
+		return err
+	}
+	return utils.WriteFileAtomic(f.Path, bts, 0600)
+}
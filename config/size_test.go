@@ -0,0 +1,61 @@
+package config_test
+
+import (
+	"baidu_tool/config"
+	"testing"
+)
+
+func TestParseByteSize(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    config.ByteSize
+		wantErr bool
+	}{
+		{in: "4194304", want: 4 << 20},
+		{in: "4MB", want: 4 << 20},
+		{in: "4m", want: 4 << 20},
+		{in: "4MiB", want: 4 << 20},
+		{in: " 1.5 KB ", want: 1536},
+		{in: "1GB", want: 1 << 30},
+		{in: "0", want: 0},
+		{in: "8191PB", wantErr: true},
+		{in: "", wantErr: true},
+		{in: "abc", wantErr: true},
+		{in: "-1MB", wantErr: true},
+		{in: "NaN", wantErr: true},
+		{in: "Inf", wantErr: true},
+		{in: "-Inf", wantErr: true},
+		{in: "1e400", wantErr: true},
+		{in: "9223372036854775807", wantErr: true},
+		{in: "8589934592GB", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := config.ParseByteSize(tt.in)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("ParseByteSize(%q) = %d, want error", tt.in, got)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("ParseByteSize(%q) = %d, %v, want %d", tt.in, got, err, tt.want)
+		}
+	}
+}
+
+func TestByteSizeString(t *testing.T) {
+	tests := []struct {
+		size config.ByteSize
+		want string
+	}{
+		{size: 4 << 20, want: "4MB"},
+		{size: 1 << 30, want: "1GB"},
+		{size: 1536, want: "1536"},
+		{size: 0, want: "0"},
+	}
+	for _, tt := range tests {
+		if got := tt.size.String(); got != tt.want {
+			t.Errorf("ByteSize(%d).String() = %q, want %q", int64(tt.size), got, tt.want)
+		}
+	}
+}
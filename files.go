@@ -0,0 +1,138 @@
+package main
+
+import (
+	"baidu_tool/baidu_api"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"path"
+	"slices"
+)
+
+// ondupModes mv、cp 的 --ondup 可选值
+var ondupModes = []string{baidu_api.OndupFail, baidu_api.OndupNewCopy, baidu_api.OndupOverwrite, baidu_api.OndupSkip}
+
+// rm 命令
+func (a *app) rm(ctx context.Context, flagSet *flag.FlagSet, args []string) error {
+	var input clientFlags
+	input.register(flagSet)
+	rest, err := parse(flagSet, args, 1, -1)
+	if err != nil {
+		return err
+	}
+	client, err := a.newClient(flagSet, &input)
+	if err != nil {
+		return err
+	}
+	paths := make([]string, 0, len(rest))
+	for _, p := range rest {
+		paths = append(paths, remotePath(p))
+	}
+	return client.Delete(ctx, paths)
+}
+
+// mv 命令
+func (a *app) mv(ctx context.Context, flagSet *flag.FlagSet, args []string) error {
+	return a.moveOrCopy(ctx, flagSet, args, (*baidu_api.Client).Move)
+}
+
+// cp 命令
+func (a *app) cp(ctx context.Context, flagSet *flag.FlagSet, args []string) error {
+	return a.moveOrCopy(ctx, flagSet, args, (*baidu_api.Client).Copy)
+}
+
+// moveOrCopy mv 和 cp 共同的流程：目标是已存在的文件夹时放到它里面，否则只能有一个源，移动或复制后命名为目标路径
+func (a *app) moveOrCopy(ctx context.Context, flagSet *flag.FlagSet, args []string, operate func(*baidu_api.Client, context.Context, []baidu_api.FileOperation, string) error) error {
+	var input struct {
+		Ondup string
+		clientFlags
+	}
+	flagSet.StringVar(&input.Ondup, "ondup", baidu_api.OndupFail, "目标已存在时的处理方式：fail 失败，newcopy 重命名，overwrite 覆盖，skip 跳过")
+	input.clientFlags.register(flagSet)
+	rest, err := parse(flagSet, args, 2, -1)
+	if err != nil {
+		return err
+	}
+	if !slices.Contains(ondupModes, input.Ondup) {
+		return usageError{fmt.Errorf("unknown ondup %q", input.Ondup)}
+	}
+	client, err := a.newClient(flagSet, &input.clientFlags)
+	if err != nil {
+		return err
+	}
+
+	sources, dest := rest[:len(rest)-1], remotePath(rest[len(rest)-1])
+	destIsDir, err := isRemoteDir(ctx, client, dest)
+	if err != nil {
+		return err
+	}
+	if !destIsDir && len(sources) > 1 {
+		return usageError{fmt.Errorf("target %s is not a directory", dest)}
+	}
+	for i, source := range sources {
+		sources[i] = remotePath(source)
+	}
+	return operate(client, ctx, fileOperations(sources, dest, destIsDir), input.Ondup)
+}
+
+// fileOperations 移动或复制的操作列表：目标是文件夹时放到它里面，否则命名为目标路径
+func fileOperations(sources []string, dest string, destIsDir bool) []baidu_api.FileOperation {
+	operations := make([]baidu_api.FileOperation, 0, len(sources))
+	for _, source := range sources {
+		if destIsDir {
+			operations = append(operations, baidu_api.FileOperation{Path: source, Dest: dest, NewName: path.Base(source)})
+		} else {
+			operations = append(operations, baidu_api.FileOperation{Path: source, Dest: path.Dir(dest), NewName: path.Base(dest)})
+		}
+	}
+	return operations
+}
+
+// mkdir 命令
+func (a *app) mkdir(ctx context.Context, flagSet *flag.FlagSet, args []string) error {
+	var input struct {
+		Parents bool
+		clientFlags
+	}
+	flagSet.BoolVar(&input.Parents, "p", false, "文件夹已存在时不报错")
+	input.clientFlags.register(flagSet)
+	rest, err := parse(flagSet, args, 1, -1)
+	if err != nil {
+		return err
+	}
+	client, err := a.newClient(flagSet, &input.clientFlags)
+	if err != nil {
+		return err
+	}
+	for _, p := range rest {
+		_, err = client.Mkdir(ctx, remotePath(p))
+		if input.Parents && errors.Is(err, baidu_api.ErrFileExists) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// isRemoteDir 网盘路径是否是已存在的文件夹，不存在时返回 false
+func isRemoteDir(ctx context.Context, client *baidu_api.Client, p string) (bool, error) {
+	if p == "/" {
+		return true, nil
+	}
+	dirResp, err := client.GetDirByList(ctx, path.Dir(p))
+	if errors.Is(err, baidu_api.ErrPathNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	for _, item := range dirResp.List {
+		if item.ServerFilename == path.Base(p) {
+			return item.IsDir == 1, nil
+		}
+	}
+	return false, nil
+}
@@ -0,0 +1,245 @@
+package main
+
+import (
+	"baidu_tool/baidu_api"
+	"baidu_tool/config"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"path"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// findActions find 的 --exec 可选值
+var findActions = []string{"", "download", "rm", "mv"}
+
+// findFilter find 的筛选条件，零值的条件不生效
+type findFilter struct {
+	Name    string
+	Regex   *regexp.Regexp
+	Type    string
+	MinSize int64
+	MaxSize int64
+	Newer   time.Time
+	Older   time.Time
+	MD5     string
+}
+
+// match 文件或文件夹是否满足所有条件，大小和 md5 条件只对文件生效
+func (f *findFilter) match(item *baidu_api.FileOrDir) bool {
+	if f.Name != "" {
+		if ok, _ := path.Match(f.Name, item.ServerFilename); !ok {
+			return false
+		}
+	}
+	if f.Regex != nil && !f.Regex.MatchString(item.ServerFilename) {
+		return false
+	}
+	switch f.Type {
+	case "f":
+		if item.IsDir == 1 {
+			return false
+		}
+	case "d":
+		if item.IsDir == 0 {
+			return false
+		}
+	}
+	if item.IsDir == 0 {
+		if item.Size < f.MinSize || (f.MaxSize > 0 && item.Size > f.MaxSize) {
+			return false
+		}
+	} else if f.MinSize > 0 || f.MaxSize > 0 || f.MD5 != "" {
+		return false
+	}
+	if f.MD5 != "" && !strings.EqualFold(item.MD5, f.MD5) {
+		return false
+	}
+	mtime := time.Unix(item.ServerMtime, 0)
+	if !f.Newer.IsZero() && !mtime.After(f.Newer) {
+		return false
+	}
+	if !f.Older.IsZero() && !mtime.Before(f.Older) {
+		return false
+	}
+	return true
+}
+
+// find 命令
+func (a *app) find(ctx context.Context, flagSet *flag.FlagSet, args []string) error {
+	var input struct {
+		Name        string
+		Regex       string
+		Type        string
+		MinSize     config.ByteSize
+		MaxSize     config.ByteSize
+		Newer       string
+		Older       string
+		MD5         string
+		Exec        string
+		Dest        string
+		Ondup       string
+		DownloadDir string
+		clientFlags
+	}
+	flagSet.StringVar(&input.Name, "name", "", "文件名匹配的通配符，如 *.jpg")
+	flagSet.StringVar(&input.Regex, "regex", "", "文件名匹配的正则表达式")
+	flagSet.StringVar(&input.Type, "type", "", "只找 f 文件或 d 文件夹")
+	flagSet.Var(&input.MinSize, "min_size", "文件最小的大小，如 100MB")
+	flagSet.Var(&input.MaxSize, "max_size", "文件最大的大小，0 为不限制")
+	flagSet.StringVar(&input.Newer, "newer", "", "修改时间晚于，可以是 2006-01-02、RFC3339 时间，或者 36h、7d 表示多久以前")
+	flagSet.StringVar(&input.Older, "older", "", "修改时间早于，格式同 newer")
+	flagSet.StringVar(&input.MD5, "md5", "", "文件的 md5")
+	flagSet.StringVar(&input.Exec, "exec", "", "对找到的文件执行：download 下载，rm 删除，mv 移动到 dest")
+	flagSet.StringVar(&input.Dest, "dest", "", "mv 的目标文件夹")
+	flagSet.StringVar(&input.Ondup, "ondup", baidu_api.OndupFail, "mv 时目标已存在的处理方式：fail 失败，newcopy 重命名，overwrite 覆盖，skip 跳过")
+	flagSet.StringVar(&input.DownloadDir, "download_dir", "", "download 保存到的本地文件夹，默认当前目录")
+	input.clientFlags.register(flagSet)
+	rest, err := parse(flagSet, args, 0, 1)
+	if err != nil {
+		return err
+	}
+
+	filter := &findFilter{
+		Name:    input.Name,
+		Type:    input.Type,
+		MinSize: int64(input.MinSize),
+		MaxSize: int64(input.MaxSize),
+		MD5:     input.MD5,
+	}
+	if _, err = path.Match(input.Name, ""); err != nil {
+		return usageError{fmt.Errorf("invalid name pattern %q", input.Name)}
+	}
+	if input.Regex != "" {
+		if filter.Regex, err = regexp.Compile(input.Regex); err != nil {
+			return usageError{err}
+		}
+	}
+	if input.Type != "" && input.Type != "f" && input.Type != "d" {
+		return usageError{fmt.Errorf("unknown type %q", input.Type)}
+	}
+	now := time.Now()
+	if filter.Newer, err = parseTimeBound(input.Newer, now); err != nil {
+		return usageError{err}
+	}
+	if filter.Older, err = parseTimeBound(input.Older, now); err != nil {
+		return usageError{err}
+	}
+	if !slices.Contains(findActions, input.Exec) {
+		return usageError{fmt.Errorf("unknown exec %q", input.Exec)}
+	}
+	if input.Exec == "mv" && input.Dest == "" {
+		return usageError{errors.New("mv needs --dest")}
+	}
+	if !slices.Contains(ondupModes, input.Ondup) {
+		return usageError{fmt.Errorf("unknown ondup %q", input.Ondup)}
+	}
+	client, err := a.newClient(flagSet, &input.clientFlags, baidu_api.WithDownloadDir(input.DownloadDir))
+	if err != nil {
+		return err
+	}
+
+	root := "/apps"
+	if len(rest) == 1 {
+		root = remotePath(rest[0])
+	}
+	// 边遍历边输出，只有要执行操作时才记下找到的
+	var matches []*baidu_api.FileOrDir
+	encoder := json.NewEncoder(a.stdout)
+	it := client.ListAll(ctx, root, 0)
+	for it.Next() {
+		item := it.Item()
+		if !filter.match(item) {
+			continue
+		}
+		if input.json() {
+			if err = encoder.Encode(item); err != nil {
+				return err
+			}
+		} else {
+			fmt.Fprintln(a.stdout, item.Path)
+		}
+		if input.Exec != "" {
+			matches = append(matches, item)
+		}
+	}
+	if err = it.Err(); err != nil {
+		return err
+	}
+	if len(matches) == 0 {
+		return nil
+	}
+
+	// 文件夹已经找到时，里面的就不用再单独处理
+	matches = outermost(matches)
+	switch input.Exec {
+	case "rm":
+		paths := make([]string, 0, len(matches))
+		for _, item := range matches {
+			paths = append(paths, item.Path)
+		}
+		return client.Delete(ctx, paths)
+	case "mv":
+		dest := remotePath(input.Dest)
+		operations := make([]baidu_api.FileOperation, 0, len(matches))
+		for _, item := range matches {
+			operations = append(operations, baidu_api.FileOperation{Path: item.Path, Dest: dest, NewName: item.ServerFilename})
+		}
+		return client.Move(ctx, operations, input.Ondup)
+	case "download":
+		return downloadItems(ctx, client, matches, root)
+	}
+	return nil
+}
+
+// outermost 去掉在其他文件夹里面的项
+func outermost(items []*baidu_api.FileOrDir) []*baidu_api.FileOrDir {
+	dirs := map[string]bool{}
+	for _, item := range items {
+		if item.IsDir == 1 {
+			dirs[item.Path] = true
+		}
+	}
+	var result []*baidu_api.FileOrDir
+	for _, item := range items {
+		inside := false
+		for dir := path.Dir(item.Path); dir != "/" && dir != "."; dir = path.Dir(dir) {
+			if dirs[dir] {
+				inside = true
+				break
+			}
+		}
+		if !inside {
+			result = append(result, item)
+		}
+	}
+	return result
+}
+
+// parseTimeBound 解析时间条件：日期、RFC3339 时间，或者 36h、7d 这样表示从 now 往前多久
+func parseTimeBound(s string, now time.Time) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	if days, ok := strings.CutSuffix(s, "d"); ok {
+		if n, err := strconv.Atoi(days); err == nil {
+			return now.AddDate(0, 0, -n), nil
+		}
+	}
+	if d, err := time.ParseDuration(s); err == nil {
+		return now.Add(-d), nil
+	}
+	if t, err := time.ParseInLocation("2006-01-02", s, time.Local); err == nil {
+		return t, nil
+	}
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	return time.Time{}, fmt.Errorf("invalid time %q", s)
+}
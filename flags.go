@@ -0,0 +1,167 @@
+package main
+
+import (
+	"baidu_tool/baidu_api"
+	"baidu_tool/config"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"slices"
+	"time"
+)
+
+// 输出格式
+const (
+	// outputText 给人看的文字和进度条
+	outputText = "text"
+	// outputJSON 每行一个 json 对象，列表命令输出 FileOrDir，传输命令输出 TransferEvent
+	outputJSON = "json"
+)
+
+// outputFormats --output 可选值
+var outputFormats = []string{outputText, outputJSON}
+
+// profileFlags 每个命令都有的账号选择参数，所有参数都可以写在配置文件里，或者用 BAIDU_TOOL_ 开头的环境变量设置
+type profileFlags struct {
+	Profile    string
+	ConfigPath string
+}
+
+func (p *profileFlags) register(flagSet *flag.FlagSet) {
+	flagSet.StringVar(&p.Profile, "profile", "", "使用配置文件中的哪个账号，默认为配置文件中的 default_profile 或 default")
+	flagSet.StringVar(&p.ConfigPath, "config", "", "配置文件路径，默认 ~/.config/baidu_tool/config.toml")
+}
+
+// apply 按 命令行 > 环境变量 > 配置文件中的账号设置 > 配置文件顶层设置 > 默认值 的优先级叠加设置，返回选中的账号名
+func (p *profileFlags) apply(flagSet *flag.FlagSet) (string, error) {
+	// 配置文件路径和账号也可以来自环境变量，所以先叠加环境变量
+	if err := config.Apply(flagSet, config.Environ(flagSet)); err != nil {
+		return "", err
+	}
+	configPath := p.ConfigPath
+	if configPath == "" {
+		var err error
+		if configPath, err = config.DefaultConfigPath(); err != nil {
+			return "", err
+		}
+	}
+	file, err := config.Load(configPath)
+	if err != nil {
+		return "", err
+	}
+	profile := file.ProfileName(p.Profile)
+	settings, err := file.Profile(profile)
+	if err != nil {
+		return "", err
+	}
+	if err = config.Apply(flagSet, settings); err != nil {
+		return "", err
+	}
+	return profile, config.Apply(flagSet, file.Global)
+}
+
+// clientFlags 需要调用网盘接口的命令共有的参数
+type clientFlags struct {
+	AccessToken     string
+	CredentialsPath string
+	RetryMax        int
+	RetryDelay      time.Duration
+	RetryMaxDelay   time.Duration
+	MetadataQPS     float64
+	UploadQPS       float64
+	DownloadQPS     float64
+	Concurrency     int
+	Output          string
+	profileFlags
+
+	// profile load 之后选中的账号
+	profile string
+	loaded  bool
+}
+
+func (f *clientFlags) register(flagSet *flag.FlagSet) {
+	flagSet.StringVar(&f.AccessToken, "access_token", "", "用户身份凭证，不传则使用 login 保存的凭证")
+	flagSet.StringVar(&f.CredentialsPath, "credentials", "", "凭证文件路径，默认 ~/.config/baidu_tool/credentials/[profile].json")
+	flagSet.IntVar(&f.RetryMax, "retry", baidu_api.DefaultRetryPolicy.MaxAttempts, "每个请求最多尝试的次数")
+	flagSet.DurationVar(&f.RetryDelay, "retry_delay", baidu_api.DefaultRetryPolicy.BaseDelay, "第一次重试前的等待时间，之后每次翻倍")
+	flagSet.DurationVar(&f.RetryMaxDelay, "retry_max_delay", baidu_api.DefaultRetryPolicy.MaxDelay, "重试等待时间的上限")
+	flagSet.Float64Var(&f.MetadataQPS, "metadata_qps", baidu_api.DefaultMetadataQPS, "列表、预上传、创建文件等接口每秒最多请求数，0 为不限制")
+	flagSet.Float64Var(&f.UploadQPS, "upload_qps", baidu_api.DefaultUploadQPS, "分片上传每秒最多请求数，0 为不限制")
+	flagSet.Float64Var(&f.DownloadQPS, "download_qps", baidu_api.DefaultDownloadQPS, "分片下载每秒最多请求数，0 为不限制")
+	flagSet.IntVar(&f.Concurrency, "concurrency", baidu_api.DefaultMaxConcurrent(), "上传下载时同时进行的网络请求数量")
+	flagSet.StringVar(&f.Output, "output", outputText, "输出格式：text 文字和进度条，json 每行一个 json 对象")
+	f.profileFlags.register(flagSet)
+}
+
+// json 是否按 json 输出
+func (f *clientFlags) json() bool {
+	return f.Output == outputJSON
+}
+
+// load 叠加环境变量和配置文件中的设置并检查共有的参数，只执行一次
+// 命令自己的参数也可能写在配置文件里，需要检查它们的命令先 load，检查通过后再 newClient
+func (f *clientFlags) load(flagSet *flag.FlagSet) error {
+	if f.loaded {
+		return nil
+	}
+	profile, err := f.apply(flagSet)
+	if err != nil {
+		return usageError{err}
+	}
+	if f.Concurrency < 1 {
+		return usageError{errors.New("concurrency must be positive")}
+	}
+	if !slices.Contains(outputFormats, f.Output) {
+		return usageError{fmt.Errorf("unknown output %q", f.Output)}
+	}
+	f.profile, f.loaded = profile, true
+	return nil
+}
+
+// newClient 叠加配置后创建 Client，没有直接传 access_token 时使用 login 保存的凭证，快过期时自动刷新并写回凭证文件
+// json 输出时不显示进度条，传输事件逐行写到标准输出
+func (a *app) newClient(flagSet *flag.FlagSet, f *clientFlags, opts ...baidu_api.ClientOption) (*baidu_api.Client, error) {
+	if err := f.load(flagSet); err != nil {
+		return nil, err
+	}
+	var clientOpts []baidu_api.ClientOption
+	if f.AccessToken == "" {
+		credentialFile, err := credentialFileAt(f.CredentialsPath, f.profile)
+		if err != nil {
+			return nil, err
+		}
+		credentials, err := loadCredentials(credentialFile)
+		if err != nil {
+			return nil, err
+		}
+		if credentials == nil {
+			return nil, errors.New("not logged in: run login first or pass --access_token")
+		}
+		f.AccessToken = credentials.AccessToken
+		clientOpts = append(clientOpts, baidu_api.WithCredentials(credentials, credentialFile))
+	}
+
+	// 每个 Client 用自己的限流器，shell 里上一个命令的参数和降速不会带到下一个命令
+	clientOpts = append(clientOpts,
+		baidu_api.WithLimiters(baidu_api.NewLimiters(f.MetadataQPS, f.UploadQPS, f.DownloadQPS)),
+		baidu_api.WithRetryPolicy(baidu_api.RetryPolicy{
+			MaxAttempts: f.RetryMax,
+			BaseDelay:   f.RetryDelay,
+			MaxDelay:    f.RetryMaxDelay,
+		}),
+		baidu_api.WithMaxConcurrent(f.Concurrency),
+	)
+	if f.json() {
+		encoder := json.NewEncoder(a.stdout)
+		clientOpts = append(clientOpts,
+			baidu_api.WithOutput(io.Discard),
+			baidu_api.WithEventHandler(func(event baidu_api.TransferEvent) {
+				_ = encoder.Encode(event)
+			}),
+		)
+	}
+	clientOpts = append(clientOpts, opts...)
+	return baidu_api.NewClient(f.AccessToken, append(clientOpts, a.clientOpts...)...), nil
+}
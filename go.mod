@@ -2,12 +2,15 @@ module baidu_tool
 
 go 1.21.1
 
-require github.com/vbauerster/mpb v3.4.0+incompatible
+require (
+	github.com/BurntSushi/toml v1.6.0
+	github.com/vbauerster/mpb v3.4.0+incompatible
+	golang.org/x/term v0.13.0
+)
 
 require (
 	github.com/VividCortex/ewma v1.2.0 // indirect
 	github.com/mattn/go-isatty v0.0.20 // indirect
 	golang.org/x/crypto v0.14.0 // indirect
 	golang.org/x/sys v0.13.0 // indirect
-	golang.org/x/term v0.13.0 // indirect
 )
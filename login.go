@@ -0,0 +1,75 @@
+package main
+
+import (
+	"baidu_tool/baidu_api"
+	"baidu_tool/config"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+)
+
+// login 命令，设备码授权登录，把拿到的 access_token 和 refresh_token 保存到凭证文件
+func (a *app) login(ctx context.Context, flagSet *flag.FlagSet, args []string) error {
+	var input struct {
+		AppKey          string
+		SecretKey       string
+		Scope           string
+		CredentialsPath string
+		profileFlags
+	}
+	flagSet.StringVar(&input.AppKey, "app_key", "", "网盘开放平台应用的 AppKey")
+	flagSet.StringVar(&input.SecretKey, "secret_key", "", "网盘开放平台应用的 SecretKey")
+	flagSet.StringVar(&input.Scope, "scope", baidu_api.DefaultOAuthScope, "授权范围")
+	flagSet.StringVar(&input.CredentialsPath, "credentials", "", "凭证文件路径，默认 ~/.config/baidu_tool/credentials/[profile].json")
+	input.profileFlags.register(flagSet)
+	if _, err := parse(flagSet, args, 0, 0); err != nil {
+		return err
+	}
+	profile, err := input.profileFlags.apply(flagSet)
+	if err != nil {
+		return usageError{err}
+	}
+	if input.AppKey == "" || input.SecretKey == "" {
+		return usageError{errors.New("login needs --app_key and --secret_key")}
+	}
+	credentialFile, err := credentialFileAt(input.CredentialsPath, profile)
+	if err != nil {
+		return err
+	}
+
+	client := baidu_api.NewClient("", a.clientOpts...)
+	credentials, err := client.DeviceLogin(ctx, input.AppKey, input.SecretKey, input.Scope, func(deviceCode *baidu_api.DeviceCode) {
+		fmt.Fprintf(a.stdout, "请在浏览器打开 %s 并输入用户码 %s\n", deviceCode.VerificationURL, deviceCode.UserCode)
+		if deviceCode.QrcodeURL != "" {
+			fmt.Fprintf(a.stdout, "也可以用百度网盘 App 扫描二维码：%s\n", deviceCode.QrcodeURL)
+		}
+		fmt.Fprintf(a.stdout, "等待授权中...\n")
+	})
+	if err != nil {
+		return err
+	}
+	if err = credentialFile.Save(credentials); err != nil {
+		return err
+	}
+	fmt.Fprintf(a.stdout, "账号 %s 登录成功，凭证已保存到 %s\n", profile, credentialFile.Path)
+	return nil
+}
+
+// credentialFileAt 指定路径的凭证文件，路径为空时使用账号对应的凭证文件
+func credentialFileAt(credentialsPath string, profile string) (*config.CredentialFile, error) {
+	if credentialsPath != "" {
+		return &config.CredentialFile{Path: credentialsPath}, nil
+	}
+	return config.ProfileCredentialFile(profile)
+}
+
+// loadCredentials 读取凭证文件，文件不存在时返回 nil
+func loadCredentials(credentialFile *config.CredentialFile) (*baidu_api.Credentials, error) {
+	credentials, err := credentialFile.Load()
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	return credentials, err
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"baidu_tool/baidu_api"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"path"
+	"slices"
+	"sort"
+	"strconv"
+	"text/tabwriter"
+	"time"
+)
+
+// listOrders ls 的 --order 可选值
+var listOrders = []string{"name", "time", "size"}
+
+// ls 命令
+func (a *app) ls(ctx context.Context, flagSet *flag.FlagSet, args []string) error {
+	var input struct {
+		Order     string
+		Reverse   bool
+		Long      bool
+		Human     bool
+		DirsFirst bool
+		PageSize  int
+		clientFlags
+	}
+	flagSet.StringVar(&input.Order, "order", "name", "排序方式：name 文件名，time 修改时间，size 大小")
+	flagSet.BoolVar(&input.Reverse, "r", false, "降序排列")
+	flagSet.BoolVar(&input.Long, "l", false, "显示大小、修改时间、md5 和 fs_id")
+	flagSet.BoolVar(&input.Human, "human", false, "大小显示为 KB、MB、GB")
+	flagSet.BoolVar(&input.DirsFirst, "dirs_first", true, "文件夹排在文件前面")
+	flagSet.IntVar(&input.PageSize, "page_size", 1000, "每次请求列出多少个，最多 1000")
+	input.clientFlags.register(flagSet)
+	rest, err := parse(flagSet, args, 0, 1)
+	if err != nil {
+		return err
+	}
+	// 排序和每页数量也可能来自配置文件，叠加配置后、读取凭证前检查
+	if err = input.clientFlags.load(flagSet); err != nil {
+		return err
+	}
+	if !slices.Contains(listOrders, input.Order) {
+		return usageError{fmt.Errorf("unknown order %q", input.Order)}
+	}
+	if input.PageSize < 1 || input.PageSize > 1000 {
+		return usageError{errors.New("page_size must be between 1 and 1000")}
+	}
+	client, err := a.newClient(flagSet, &input.clientFlags)
+	if err != nil {
+		return err
+	}
+
+	dirPath := "/apps"
+	if len(rest) == 1 {
+		dirPath = remotePath(rest[0])
+	}
+	list, err := listPath(ctx, client, dirPath, baidu_api.ListOptions{
+		Order:    input.Order,
+		Desc:     input.Reverse,
+		PageSize: input.PageSize,
+	})
+	if err != nil {
+		return err
+	}
+	if input.DirsFirst {
+		// 百度已经按要求排好序，只需要把文件夹挪到前面
+		sort.SliceStable(list, func(i, j int) bool {
+			return list[i].IsDir > list[j].IsDir
+		})
+	}
+	if input.json() {
+		return printJSONList(a.stdout, list)
+	}
+	if input.Long {
+		return printLongList(a.stdout, list, input.Human)
+	}
+	for _, item := range list {
+		fmt.Fprintln(a.stdout, displayName(item))
+	}
+	return nil
+}
+
+// listPath 列出文件夹下的内容，路径是文件时只返回这个文件
+func listPath(ctx context.Context, client *baidu_api.Client, p string, opts baidu_api.ListOptions) ([]*baidu_api.FileOrDir, error) {
+	list, err := client.ListDir(ctx, p, opts)
+	if !errors.Is(err, baidu_api.ErrPathNotFound) || p == "/" {
+		return list, err
+	}
+	// 不是文件夹，到上一层找这个文件
+	siblings, parentErr := client.ListDir(ctx, path.Dir(p), baidu_api.ListOptions{})
+	if parentErr != nil {
+		return nil, err
+	}
+	for _, item := range siblings {
+		if item.ServerFilename == path.Base(p) {
+			return []*baidu_api.FileOrDir{item}, nil
+		}
+	}
+	return nil, fmt.Errorf("%s: %w", p, baidu_api.ErrPathNotFound)
+}
+
+// displayName 文件夹名后面加 /
+func displayName(item *baidu_api.FileOrDir) string {
+	if item.IsDir == 1 {
+		return item.ServerFilename + "/"
+	}
+	return item.ServerFilename
+}
+
+// printLongList 按列打印详细信息
+func printLongList(out io.Writer, list []*baidu_api.FileOrDir, human bool) error {
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', tabwriter.AlignRight)
+	for _, item := range list {
+		size, md5 := "-", "-"
+		if item.IsDir == 0 {
+			size = strconv.FormatInt(item.Size, 10)
+			if human {
+				size = humanSize(item.Size)
+			}
+			md5 = item.MD5
+		}
+		mtime := time.Unix(item.ServerMtime, 0).Format("2006-01-02 15:04")
+		fmt.Fprintf(w, "%s\t%s\t %s\t %d\t %s\n", size, mtime, md5, item.FsId, displayName(item))
+	}
+	return w.Flush()
+}
+
+// printJSONList 每行一个 FileOrDir
+func printJSONList(out io.Writer, list []*baidu_api.FileOrDir) error {
+	encoder := json.NewEncoder(out)
+	for _, item := range list {
+		if err := encoder.Encode(item); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// humanSize 按 1024 进位显示大小
+func humanSize(size int64) string {
+	const unit = 1024
+	if size < unit {
+		return fmt.Sprintf("%dB", size)
+	}
+	value, suffix := float64(size), ""
+	for _, s := range []string{"K", "M", "G", "T", "P"} {
+		value /= unit
+		suffix = s
+		if value < unit {
+			break
+		}
+	}
+	return fmt.Sprintf("%.1f%s", value, suffix)
+}
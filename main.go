@@ -2,118 +2,186 @@ package main
 
 import (
 	"baidu_tool/baidu_api"
-	"baidu_tool/utils"
+	"context"
+	"errors"
 	"flag"
 	"fmt"
-	"github.com/vbauerster/mpb"
-	"log"
+	"io"
+	"os"
+	"os/signal"
+	"sort"
 	"strings"
+	"syscall"
 )
 
+// 退出码
+const (
+	exitOK    = 0
+	exitError = 1
+	exitUsage = 2
+)
+
+// usageError 参数不对，打印命令帮助后以 exitUsage 退出
+type usageError struct {
+	err error
+}
+
+func (e usageError) Error() string {
+	return e.err.Error()
+}
+
+func (e usageError) Unwrap() error {
+	return e.err
+}
+
+// command 一个子命令
+type command struct {
+	// name 命令名
+	name string
+	// args 位置参数说明，如 <本地路径>
+	args string
+	// short 一句话说明
+	short string
+	// run 执行命令，flagSet 已经创建好，由命令自己注册参数并解析 args
+	run func(a *app, ctx context.Context, flagSet *flag.FlagSet, args []string) error
+}
+
+// commands 所有子命令，按名字排序后展示
+var commands = []*command{
+	{name: "upload", args: "<本地文件或文件夹>", short: "上传到 我的应用数据 下", run: (*app).upload},
+	{name: "download", args: "<网盘文件或文件夹>", short: "下载网盘中的文件或文件夹", run: (*app).download},
+	{name: "jigsaw", args: "<碎片文件夹>", short: "把拆分上传的超大文件碎片拼接回来", run: (*app).jigsaw},
+	{name: "ls", args: "[网盘文件夹]", short: "列出文件夹中的内容，默认 我的应用数据", run: (*app).ls},
+	{name: "login", short: "设备码授权登录并保存凭证", run: (*app).login},
+	{name: "rm", args: "<网盘路径>...", short: "删除文件或文件夹", run: (*app).rm},
+	{name: "mv", args: "<源路径>... <目标路径>", short: "移动或重命名文件或文件夹", run: (*app).mv},
+	{name: "cp", args: "<源路径>... <目标路径>", short: "复制文件或文件夹", run: (*app).cp},
+	{name: "mkdir", args: "<网盘文件夹>...", short: "创建文件夹", run: (*app).mkdir},
+	{name: "du", args: "[网盘文件夹]", short: "统计每个文件夹占用的空间和文件数", run: (*app).du},
+	{name: "tree", args: "[网盘文件夹]", short: "按层级显示文件夹内容和大小", run: (*app).tree},
+	{name: "find", args: "[网盘文件夹]", short: "按名字、大小、时间等条件查找文件，可以直接下载、删除或移动", run: (*app).find},
+	{name: "search", args: "<关键词>", short: "使用网盘的搜索接口按文件名查找", run: (*app).search},
+	{name: "stat", args: "<网盘路径>...", short: "查看文件的详细信息，不需要下载", run: (*app).stat},
+	{name: "verify", args: "<网盘文件或文件夹>", short: "用网盘记录的大小和 md5 核对已经下载的文件，可以重新下载不对的", run: (*app).verify},
+	{name: "quota", short: "查看网盘总空间、已用和剩余空间以及账号信息", run: (*app).quota},
+	{name: "shell", short: "交互模式，可以 cd 到网盘文件夹后执行 ls、get、put 等命令，支持 tab 补全", run: (*app).shell},
+	{name: "whoami", short: "查看当前账号的用户名和会员类型，同 quota", run: (*app).quota},
+}
+
+// app 命令运行的环境，测试时可以替换输出和接口地址
+type app struct {
+	stdin  io.Reader
+	stdout io.Writer
+	stderr io.Writer
+	// clientOpts 创建 Client 时额外的配置，测试时用来指向假服务
+	clientOpts []baidu_api.ClientOption
+}
+
 func main() {
-	var input struct {
-		IsUpload        bool
-		IsJigsaw        bool
-		AccessToken     string
-		Path            string
-		BaiduPrefixPath string
+	// Ctrl-C 时取消上传下载，等所有协程退出后再结束
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	a := &app{stdin: os.Stdin, stdout: os.Stdout, stderr: os.Stderr}
+	code := a.run(ctx, os.Args[1:])
+	stop()
+	os.Exit(code)
+}
+
+// run 找到子命令并执行，返回退出码
+func (a *app) run(ctx context.Context, args []string) int {
+	if len(args) == 0 {
+		a.usage()
+		return exitUsage
 	}
-	flag.BoolVar(&input.IsUpload, "upload", false, "使用上传功能，默认使用下载功能")
-	flag.BoolVar(&input.IsJigsaw, "jigsaw", false, "使用拼接功能，默认使用下载功能，与上传同在时无效")
-	flag.StringVar(&input.AccessToken, "access_token", "", "用户身份凭证")
-	flag.StringVar(&input.Path, "path", "", "文件或文件夹路径")
-	flag.StringVar(&input.BaiduPrefixPath, "prefix", "", "上传到百度网盘后所在的文件位置前缀部分，不传则直接在 我的应用数据 目录")
-	flag.Parse()
-	if input.AccessToken == "" {
-		fmt.Printf("input access_token by --access_token [your access token]\n")
+	name := args[0]
+	if name == "help" || name == "-h" || name == "--help" || name == "-help" {
+		if len(args) > 1 {
+			if cmd := findCommand(args[1]); cmd != nil {
+				flagSet := a.newFlagSet(cmd)
+				// 传 -h 让命令注册完参数就返回
+				_ = cmd.run(a, ctx, flagSet, []string{"-h"})
+				a.commandUsage(cmd, flagSet)
+				return exitOK
+			}
+		}
+		a.usage()
+		return exitOK
 	}
-	if input.Path == "" {
-		fmt.Printf("input file/dir path by --path [file/dir path]\n")
+	cmd := findCommand(name)
+	if cmd == nil {
+		fmt.Fprintf(a.stderr, "unknown command %q\n\n", name)
+		a.usage()
+		return exitUsage
 	}
 
-	if input.IsUpload {
-		// 上传
-		baiduPrefixPath := baidu_api.ParseBaiduPrefixPath(input.BaiduPrefixPath)
-		// 如果前缀是 ./ ，可以去除
-		input.Path = strings.TrimPrefix(input.Path, "./")
-		// 本地的文件路径如果最后有 / 要去除
-		input.Path = strings.TrimSuffix(input.Path, "/")
-		// 解析出文件或文件夹下所有要上传的文件
-		filePathList, err := utils.GetFilePathListFromLocalPath(input.Path)
-		if err != nil {
-			log.Println(err)
-			return
-		}
-		// 多个文件的上传共用一个 mpb 进度
-		progress := mpb.New()
+	flagSet := a.newFlagSet(cmd)
+	err := cmd.run(a, ctx, flagSet, args[1:])
+	var usageErr usageError
+	switch {
+	case err == nil:
+		return exitOK
+	case errors.Is(err, flag.ErrHelp):
+		a.commandUsage(cmd, flagSet)
+		return exitOK
+	case errors.As(err, &usageErr):
+		fmt.Fprintf(a.stderr, "%s: %v\n\n", cmd.name, err)
+		a.commandUsage(cmd, flagSet)
+		return exitUsage
+	default:
+		fmt.Fprintf(a.stderr, "%s: %v\n", cmd.name, err)
+		return exitError
+	}
+}
 
-		if err = baidu_api.UploadFileOrDir(input.AccessToken, filePathList, baiduPrefixPath, progress); err != nil {
-			log.Println(err)
-			return
-		}
+// newFlagSet 命令自己的参数集，解析出错时不打印也不退出，由 run 统一处理
+func (a *app) newFlagSet(cmd *command) *flag.FlagSet {
+	flagSet := flag.NewFlagSet(cmd.name, flag.ContinueOnError)
+	flagSet.SetOutput(io.Discard)
+	flagSet.Usage = func() {}
+	return flagSet
+}
 
-	} else if input.IsJigsaw {
-		// 拼接
+// commandUsage 命令的帮助
+func (a *app) commandUsage(cmd *command, flagSet *flag.FlagSet) {
+	fmt.Fprintf(a.stderr, "用法: baidu_tool %s [参数] %s\n%s\n\n参数:\n", cmd.name, cmd.args, cmd.short)
+	flagSet.SetOutput(a.stderr)
+	flagSet.PrintDefaults()
+}
 
-		if err := utils.JigsawSlicedFiles(input.Path); err != nil {
-			panic(err)
-			return
-		}
-	} else {
-		// 下载
-
-		// 开始搜索，找文件信息
-		dirResp, err := baidu_api.GetFileOrDirResp(input.AccessToken, input.Path)
-		if err != nil {
-			log.Println(err)
-			return
+// parse 解析参数并检查位置参数的数量，max 小于 0 时不限制上限
+func parse(flagSet *flag.FlagSet, args []string, min int, max int) ([]string, error) {
+	if err := flagSet.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return nil, err
 		}
-		// 如果文件夹信息中没有内容，那么要么是文件，要么是没有
-		if dirResp.List == nil || len(dirResp.List) == 0 {
-			// 退回上一层路径，用列表再次搜索
-			parentDir, file, err := utils.DivideDirAndFile(input.Path)
-			if err != nil {
-				log.Println(err)
-				return
-			}
-			dirListResp, err := baidu_api.GetDirByList(input.AccessToken, parentDir)
-			if err != nil {
-				log.Println(err)
-				return
-			}
-			// 看看这次 list 中有没有 file
-			if dirListResp.List == nil || len(dirListResp.List) == 0 {
-				fmt.Printf("not found %s\n", input.Path)
-				return
-			} else {
-				// 找到 list 里的 file，只下载这个 file
-				foundFile := false
-				for _, item := range dirListResp.List {
-					if item.ServerFilename == file {
-						// 直接下载这个文件，不需要前面的目录
-						err = baidu_api.DownloadFileOrDir(input.AccessToken, []*baidu_api.FileOrDir{item}, parentDir)
-						if err != nil {
-							log.Println(err)
-							return
-						}
-						foundFile = true
-						break
-					}
-				}
-				if !foundFile {
-					fmt.Printf("not found %s, but found %s\n", file, parentDir)
-					return
-				}
-			}
-		} else {
-			// 下载文件夹时，不需要前面的冗余文件夹，找出该 path 的前面的文件夹
-			parentDir, _, err := utils.DivideDirAndFile(input.Path)
-			// 找到了，那么这是个文件夹，下载该文件夹和其内部所有文件
-			err = baidu_api.DownloadFileOrDir(input.AccessToken, dirResp.List, parentDir)
-			if err != nil {
-				log.Println(err)
-				return
-			}
+		return nil, usageError{err}
+	}
+	rest := flagSet.Args()
+	if len(rest) < min || (max >= 0 && len(rest) > max) {
+		return nil, usageError{fmt.Errorf("wrong number of arguments: %s", strings.Join(rest, " "))}
+	}
+	return rest, nil
+}
+
+func findCommand(name string) *command {
+	for _, cmd := range commands {
+		if cmd.name == name {
+			return cmd
 		}
 	}
+	return nil
+}
+
+// usage 总的帮助
+func (a *app) usage() {
+	fmt.Fprintf(a.stderr, "用法: baidu_tool <命令> [参数]\n\n命令:\n")
+	sorted := append([]*command(nil), commands...)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].name < sorted[j].name
+	})
+	for _, cmd := range sorted {
+		fmt.Fprintf(a.stderr, "  %-10s %s\n", cmd.name, cmd.short)
+	}
+	fmt.Fprintf(a.stderr, "\n使用 baidu_tool help <命令> 查看命令的参数\n")
 }
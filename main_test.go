@@ -0,0 +1,696 @@
+package main
+
+import (
+	"baidu_tool/baidu_api"
+	"baidu_tool/baidu_api/fakepan"
+	"baidu_tool/config"
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newTestApp 启动假服务并返回指向它的 app，配置目录换成临时目录，默认账号已经登录
+func newTestApp(t *testing.T) (*fakepan.Server, *app, *bytes.Buffer) {
+	t.Helper()
+	server := fakepan.NewServer("test-token")
+	t.Cleanup(server.Close)
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	t.Setenv("HOME", t.TempDir())
+	credentialFile, err := config.ProfileCredentialFile(config.DefaultProfile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = credentialFile.Save(&baidu_api.Credentials{AccessToken: "test-token"}); err != nil {
+		t.Fatal(err)
+	}
+	stdout := &bytes.Buffer{}
+	a := &app{
+		stdout: stdout,
+		stderr: &bytes.Buffer{},
+		clientOpts: []baidu_api.ClientOption{
+			baidu_api.WithPanBaseURL(server.URL),
+			baidu_api.WithPCSBaseURL(server.URL),
+			baidu_api.WithOAuthBaseURL(server.URL),
+			baidu_api.WithLimiters(nil),
+		},
+	}
+	return server, a, stdout
+}
+
+// runApp 执行命令并检查退出码
+func runApp(t *testing.T, a *app, wantCode int, args ...string) {
+	t.Helper()
+	if code := a.run(context.Background(), args); code != wantCode {
+		t.Fatalf("%v exit code %d, want %d, stderr:\n%s", args, code, wantCode, a.stderr)
+	}
+}
+
+func chdir(t *testing.T, dir string) {
+	t.Helper()
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		_ = os.Chdir(wd)
+	})
+}
+
+func TestUploadAndDownloadCommands(t *testing.T) {
+	server, a, _ := newTestApp(t)
+	chdir(t, t.TempDir())
+
+	if err := os.MkdirAll("photos/2023", 0750); err != nil {
+		t.Fatal(err)
+	}
+	content := []byte("a small picture")
+	if err := os.WriteFile("photos/2023/cat.jpg", content, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	runApp(t, a, exitOK, "upload", "--prefix", "/backup/", "./photos/")
+	if got, ok := server.ReadFile("/apps/backup/photos/2023/cat.jpg"); !ok || !bytes.Equal(got, content) {
+		t.Fatalf("uploaded file missing or wrong: %q", got)
+	}
+
+	// 下载单个文件时走退回上一层 list 的流程，文件落在当前目录
+	runApp(t, a, exitOK, "download", "/apps/backup/photos/2023/cat.jpg")
+	if got, err := os.ReadFile("cat.jpg"); err != nil || !bytes.Equal(got, content) {
+		t.Fatalf("downloaded file missing or wrong: %q %v", got, err)
+	}
+
+	// 下载文件夹时保留文件夹本身，相对路径在 /apps 下
+	if err := os.RemoveAll("photos"); err != nil {
+		t.Fatal(err)
+	}
+	runApp(t, a, exitOK, "download", "--download_dir", "out", "backup/photos")
+	if got, err := os.ReadFile("out/photos/2023/cat.jpg"); err != nil || !bytes.Equal(got, content) {
+		t.Fatalf("downloaded dir file missing or wrong: %q %v", got, err)
+	}
+
+	runApp(t, a, exitError, "download", "backup/missing.jpg")
+}
+
+func TestFileCommands(t *testing.T) {
+	server, a, _ := newTestApp(t)
+	server.PutFile("/apps/a.txt", []byte("a"))
+	server.PutFile("/apps/b.txt", []byte("b"))
+
+	runApp(t, a, exitOK, "mkdir", "docs", "/apps/archive/2023")
+	runApp(t, a, exitError, "mkdir", "docs")
+	runApp(t, a, exitOK, "mkdir", "-p", "docs")
+
+	// 目标是文件夹时放到里面
+	runApp(t, a, exitOK, "cp", "a.txt", "b.txt", "docs")
+	for _, p := range []string{"/apps/a.txt", "/apps/docs/a.txt", "/apps/docs/b.txt"} {
+		if _, ok := server.Stat(p); !ok {
+			t.Fatalf("%s missing after cp", p)
+		}
+	}
+	// 目标不存在时重命名
+	runApp(t, a, exitOK, "mv", "a.txt", "archive/2023/c.txt")
+	if _, ok := server.Stat("/apps/a.txt"); ok {
+		t.Fatal("a.txt still exists after mv")
+	}
+	if got, ok := server.ReadFile("/apps/archive/2023/c.txt"); !ok || string(got) != "a" {
+		t.Fatalf("mv target content %q", got)
+	}
+	// 目标已存在
+	runApp(t, a, exitError, "mv", "b.txt", "archive/2023/c.txt")
+	runApp(t, a, exitOK, "mv", "--ondup", "overwrite", "b.txt", "archive/2023/c.txt")
+	if got, _ := server.ReadFile("/apps/archive/2023/c.txt"); string(got) != "b" {
+		t.Fatalf("overwritten content %q", got)
+	}
+	// 多个源时目标必须是文件夹
+	runApp(t, a, exitUsage, "cp", "docs/a.txt", "docs/b.txt", "missing")
+
+	runApp(t, a, exitOK, "rm", "docs", "archive/2023/c.txt")
+	for _, p := range []string{"/apps/docs", "/apps/docs/a.txt", "/apps/archive/2023/c.txt"} {
+		if _, ok := server.Stat(p); ok {
+			t.Fatalf("%s still exists after rm", p)
+		}
+	}
+	runApp(t, a, exitError, "rm", "docs")
+}
+
+func TestUsageErrors(t *testing.T) {
+	_, a, _ := newTestApp(t)
+
+	runApp(t, a, exitUsage)
+	runApp(t, a, exitUsage, "unknown")
+	runApp(t, a, exitUsage, "upload")
+	runApp(t, a, exitUsage, "download", "a", "b")
+	runApp(t, a, exitUsage, "rm", "--no_such_flag", "a")
+	runApp(t, a, exitUsage, "mv", "--ondup", "maybe", "a", "b")
+	runApp(t, a, exitUsage, "rm", "--profile", "missing", "a")
+	runApp(t, a, exitOK, "help", "mv")
+	if !strings.Contains(a.stderr.(*bytes.Buffer).String(), "-ondup") {
+		t.Fatalf("help mv does not show its flags:\n%s", a.stderr)
+	}
+	runApp(t, a, exitOK, "mkdir", "-h")
+
+	// 没有登录也没有传 access_token
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	runApp(t, a, exitError, "rm", "a")
+	// 参数不对时在读取凭证之前就报用法错误
+	runApp(t, a, exitUsage, "upload", "--chunk_size", "0", "a")
+	runApp(t, a, exitUsage, "download", "--download_slice_size", "0", "a")
+	runApp(t, a, exitUsage, "ls", "--order", "random")
+	runApp(t, a, exitUsage, "ls", "--page_size", "0")
+	// 环境变量和配置文件里的值也要检查
+	t.Setenv("BAIDU_TOOL_PAGE_SIZE", "5000")
+	runApp(t, a, exitUsage, "ls")
+	t.Setenv("BAIDU_TOOL_CHUNK_SIZE", "0")
+	runApp(t, a, exitUsage, "upload", "a")
+}
+
+func TestLoginCommand(t *testing.T) {
+	server, a, _ := newTestApp(t)
+	credentialsPath := filepath.Join(t.TempDir(), "credentials.json")
+
+	// 第一次轮询时还没授权，之后再模拟用户在浏览器里输入用户码同意
+	out := &lineWriter{lines: make(chan string, 16)}
+	go func() {
+		fields := strings.Fields(<-out.lines)
+		userCode := fields[len(fields)-1]
+		for server.Requests("device_token") == 0 {
+			time.Sleep(10 * time.Millisecond)
+		}
+		server.ApproveDevice(userCode)
+	}()
+	a.stdout = out
+	runApp(t, a, exitOK, "login", "--app_key", "ak", "--secret_key", "sk", "--credentials", credentialsPath)
+	if server.Requests("device_token") < 2 {
+		t.Fatalf("expected polling until approved, got %d polls", server.Requests("device_token"))
+	}
+
+	info, err := os.Stat(credentialsPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Fatalf("credentials mode = %v", info.Mode().Perm())
+	}
+	credentials, err := loadCredentials(&config.CredentialFile{Path: credentialsPath})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if credentials.RefreshToken != server.RefreshToken() {
+		t.Fatalf("saved refresh token %q, want %q", credentials.RefreshToken, server.RefreshToken())
+	}
+	// 新签发的 token 可以直接调用接口
+	accessToken := credentials.AccessToken
+	client := baidu_api.NewClient(accessToken,
+		baidu_api.WithPanBaseURL(server.URL),
+		baidu_api.WithLimiters(nil),
+	)
+	if _, err = client.GetDirByList(context.Background(), "/"); err != nil {
+		t.Fatalf("list with saved token %q: %v", accessToken, err)
+	}
+}
+
+// lineWriter 把每次写入的内容发到 lines，测试从中读出提示的用户码
+type lineWriter struct {
+	lines chan string
+}
+
+func (w *lineWriter) Write(p []byte) (int, error) {
+	select {
+	case w.lines <- strings.TrimSpace(string(p)):
+	default:
+	}
+	return len(p), nil
+}
+
+func TestProfileSettings(t *testing.T) {
+	configPath := filepath.Join(t.TempDir(), "config.toml")
+	err := os.WriteFile(configPath, []byte(`
+default_profile = "personal"
+upload_qps = 4
+retry_delay = "2s"
+
+[profiles.personal]
+prefix = "archive"
+
+[profiles.work]
+prefix = "project"
+upload_qps = 2.5
+retry_delay = "3s"
+`), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	parse := func(args ...string) (string, string, float64, time.Duration, error) {
+		var p profileFlags
+		var prefix string
+		var uploadQPS float64
+		var retryDelay time.Duration
+		flagSet := flag.NewFlagSet("test", flag.ContinueOnError)
+		flagSet.StringVar(&prefix, "prefix", "", "")
+		flagSet.Float64Var(&uploadQPS, "upload_qps", 10, "")
+		flagSet.DurationVar(&retryDelay, "retry_delay", time.Second, "")
+		p.register(flagSet)
+		if err := flagSet.Parse(append([]string{"--config", configPath}, args...)); err != nil {
+			return "", "", 0, 0, err
+		}
+		profile, err := p.apply(flagSet)
+		return profile, prefix, uploadQPS, retryDelay, err
+	}
+
+	// 顶层设置所有账号共用
+	profile, prefix, uploadQPS, retryDelay, err := parse()
+	if err != nil || profile != "personal" || prefix != "archive" || uploadQPS != 4 || retryDelay != 2*time.Second {
+		t.Fatalf("default profile: %s %s %v %v %v", profile, prefix, uploadQPS, retryDelay, err)
+	}
+	// 命令行显式传的参数优先
+	profile, prefix, uploadQPS, retryDelay, err = parse("--profile", "work", "--prefix", "other")
+	if err != nil || profile != "work" || prefix != "other" || uploadQPS != 2.5 || retryDelay != 3*time.Second {
+		t.Fatalf("work profile: %s %s %v %v %v", profile, prefix, uploadQPS, retryDelay, err)
+	}
+	// 环境变量覆盖配置文件，命令行覆盖环境变量
+	t.Setenv("BAIDU_TOOL_PROFILE", "work")
+	t.Setenv("BAIDU_TOOL_UPLOAD_QPS", "1")
+	t.Setenv("BAIDU_TOOL_PREFIX", "env")
+	profile, prefix, uploadQPS, retryDelay, err = parse("--prefix", "flag")
+	if err != nil || profile != "work" || prefix != "flag" || uploadQPS != 1 || retryDelay != 3*time.Second {
+		t.Fatalf("env: %s %s %v %v %v", profile, prefix, uploadQPS, retryDelay, err)
+	}
+	if _, _, _, _, err = parse("--profile", "missing"); err == nil {
+		t.Fatal("expected error for unknown profile")
+	}
+}
+
+func TestQPSFlagsKeepDefaultLimiters(t *testing.T) {
+	server, a, _ := newTestApp(t)
+	server.Mkdir("/apps/tool")
+	// 命令的限流参数只作用于这个命令的 Client，不改进程共用的限流器
+	runApp(t, a, 0, "ls", "--metadata_qps", "1", "--download_qps", "2", "tool")
+	if qps := baidu_api.DefaultLimiters.Metadata.QPS(); qps != baidu_api.DefaultMetadataQPS {
+		t.Fatalf("metadata qps changed to %v", qps)
+	}
+	if qps := baidu_api.DefaultLimiters.Download.QPS(); qps != baidu_api.DefaultDownloadQPS {
+		t.Fatalf("download qps changed to %v", qps)
+	}
+}
+
+func TestListCommand(t *testing.T) {
+	server, a, stdout := newTestApp(t)
+	for i := 0; i < 25; i++ {
+		server.PutFile(fmt.Sprintf("/apps/data/f%02d.bin", i), make([]byte, i*100))
+	}
+	server.Mkdir("/apps/data/zdir")
+
+	// 分页取完，按大小降序，文件夹在前
+	runApp(t, a, exitOK, "ls", "--page_size", "10", "--order", "size", "-r", "data")
+	lines := strings.Split(strings.TrimSpace(stdout.String()), "\n")
+	if len(lines) != 26 {
+		t.Fatalf("expected 26 entries, got %d:\n%s", len(lines), stdout)
+	}
+	if lines[0] != "zdir/" || lines[1] != "f24.bin" || lines[25] != "f00.bin" {
+		t.Fatalf("unexpected order: %v", lines)
+	}
+	if n := server.Requests("list"); n != 3 {
+		t.Fatalf("expected 3 pages, got %d", n)
+	}
+
+	stdout.Reset()
+	runApp(t, a, exitOK, "ls", "-l", "data/f03.bin")
+	f, _ := server.Stat("/apps/data/f03.bin")
+	fields := strings.Fields(stdout.String())
+	if len(fields) != 6 || fields[0] != "300" || fields[3] != f.MD5 || fields[4] != fmt.Sprint(f.FsID) || fields[5] != "f03.bin" {
+		t.Fatalf("unexpected long format: %q", stdout)
+	}
+
+	runApp(t, a, exitError, "ls", "data/missing")
+	runApp(t, a, exitUsage, "ls", "--order", "color")
+}
+
+func TestJSONOutput(t *testing.T) {
+	server, a, stdout := newTestApp(t)
+	chdir(t, t.TempDir())
+	server.PutFile("/apps/data/a.txt", []byte("hello"))
+
+	runApp(t, a, exitOK, "ls", "--output", "json", "data")
+	var item baidu_api.FileOrDir
+	if err := json.Unmarshal(stdout.Bytes(), &item); err != nil || item.Path != "/apps/data/a.txt" || item.Size != 5 {
+		t.Fatalf("unexpected ls record %+v: %v\n%s", item, err, stdout)
+	}
+
+	// 每行一个事件，依次是 started、progress、completed
+	events := func() []baidu_api.TransferEvent {
+		t.Helper()
+		var events []baidu_api.TransferEvent
+		for _, line := range strings.Split(strings.TrimSpace(stdout.String()), "\n") {
+			var event baidu_api.TransferEvent
+			if err := json.Unmarshal([]byte(line), &event); err != nil {
+				t.Fatalf("line %q is not json: %v", line, err)
+			}
+			events = append(events, event)
+		}
+		return events
+	}
+	stdout.Reset()
+	runApp(t, a, exitOK, "download", "--output", "json", "data")
+	got := events()
+	if len(got) != 3 || got[0].Type != baidu_api.EventStarted || got[2].Type != baidu_api.EventCompleted ||
+		got[2].Op != baidu_api.OpDownload || got[2].Transferred != 5 || got[2].LocalPath != filepath.Join("data", "a.txt") {
+		t.Fatalf("unexpected download events: %+v", got)
+	}
+
+	stdout.Reset()
+	server.Fail("create", 1, 0, 31061)
+	runApp(t, a, exitError, "upload", "--output", "json", "--retry", "1", "data")
+	got = events()
+	last := got[len(got)-1]
+	if got[0].Type != baidu_api.EventStarted || last.Type != baidu_api.EventFailed || last.Errno != 31061 || last.Path != "/apps/data/a.txt" {
+		t.Fatalf("unexpected upload events: %+v", got)
+	}
+
+	runApp(t, a, exitUsage, "ls", "--output", "yaml")
+}
+
+func TestUsageCommands(t *testing.T) {
+	server, a, stdout := newTestApp(t)
+	server.PutFile("/apps/data/a.txt", make([]byte, 100))
+	server.PutFile("/apps/data/sub/b.bin", make([]byte, 300))
+	server.PutFile("/apps/data/sub/deep/c.bin", make([]byte, 50))
+	server.Mkdir("/apps/data/empty")
+
+	runApp(t, a, exitOK, "du", "--depth", "1", "data")
+	want := "  450  3 /apps/data\n" +
+		"  350  2 /apps/data/sub\n" +
+		"    0  0 /apps/data/empty\n"
+	if stdout.String() != want {
+		t.Fatalf("unexpected du output:\n%s", stdout)
+	}
+
+	stdout.Reset()
+	runApp(t, a, exitOK, "du", "--output", "json", "--order", "name", "data/sub")
+	var usage dirUsage
+	line, _, _ := strings.Cut(stdout.String(), "\n")
+	if err := json.Unmarshal([]byte(line), &usage); err != nil || usage.Path != "/apps/data/sub" || usage.Size != 350 || usage.Files != 2 || usage.Dirs != 1 {
+		t.Fatalf("unexpected du json %+v: %v", usage, err)
+	}
+
+	stdout.Reset()
+	runApp(t, a, exitOK, "tree", "data")
+	want = "/apps/data (450)\n" +
+		"├── empty/ (0)\n" +
+		"├── sub/ (350)\n" +
+		"│   ├── deep/ (50)\n" +
+		"│   │   └── c.bin (50)\n" +
+		"│   └── b.bin (300)\n" +
+		"└── a.txt (100)\n" +
+		"\n3 directories, 3 files\n"
+	if stdout.String() != want {
+		t.Fatalf("unexpected tree output:\n%s", stdout)
+	}
+
+	stdout.Reset()
+	runApp(t, a, exitOK, "tree", "--output", "json", "--depth", "1", "data")
+	var node treeNode
+	if err := json.Unmarshal(stdout.Bytes(), &node); err != nil || len(node.Children) != 3 || node.Children[1].Size != 350 || node.Children[1].Children != nil {
+		t.Fatalf("unexpected tree json %+v: %v", node, err)
+	}
+}
+
+func TestFindCommand(t *testing.T) {
+	server, a, stdout := newTestApp(t)
+	chdir(t, t.TempDir())
+	server.PutFile("/apps/data/a.jpg", make([]byte, 100))
+	server.PutFile("/apps/data/2023/b.jpg", make([]byte, 300))
+	server.PutFile("/apps/data/2023/c.log", make([]byte, 50))
+	server.PutFile("/apps/data/tmp/d.jpg", make([]byte, 10))
+
+	lines := func() []string {
+		defer stdout.Reset()
+		return strings.Fields(stdout.String())
+	}
+	runApp(t, a, exitOK, "find", "--name", "*.jpg", "--min_size", "50", "--newer", "1h", "data")
+	if got := lines(); !slices.Equal(got, []string{"/apps/data/2023/b.jpg", "/apps/data/a.jpg"}) {
+		t.Fatalf("unexpected matches: %v", got)
+	}
+	runApp(t, a, exitOK, "find", "--older", "1h", "data")
+	if got := lines(); len(got) != 0 {
+		t.Fatalf("expected nothing older than an hour, got %v", got)
+	}
+	runApp(t, a, exitOK, "find", "--regex", `^\d+$`, "--type", "d", "--output", "json", "data")
+	var item baidu_api.FileOrDir
+	if err := json.Unmarshal(stdout.Bytes(), &item); err != nil || item.Path != "/apps/data/2023" || item.IsDir != 1 {
+		t.Fatalf("unexpected json match %+v: %v", item, err)
+	}
+	stdout.Reset()
+
+	runApp(t, a, exitOK, "find", "--name", "*.jpg", "--exec", "download", "--download_dir", "out", "data")
+	lines()
+	for _, name := range []string{"out/a.jpg", "out/2023/b.jpg", "out/tmp/d.jpg"} {
+		if _, err := os.Stat(name); err != nil {
+			t.Fatalf("%s not downloaded: %v", name, err)
+		}
+	}
+
+	runApp(t, a, exitOK, "find", "--name", "*.log", "--exec", "mv", "--dest", "archive", "data")
+	runApp(t, a, exitOK, "find", "--name", "tmp", "--exec", "rm", "data")
+	lines()
+	if _, ok := server.Stat("/apps/archive/c.log"); !ok {
+		t.Fatal("c.log not moved")
+	}
+	if _, ok := server.Stat("/apps/data/tmp"); ok {
+		t.Fatal("tmp not removed")
+	}
+
+	runApp(t, a, exitUsage, "find", "--newer", "yesterday")
+	runApp(t, a, exitUsage, "find", "--exec", "mv")
+}
+
+func TestSearchCommand(t *testing.T) {
+	server, a, stdout := newTestApp(t)
+	chdir(t, t.TempDir())
+	server.PutFile("/apps/photos/2023/trip.jpg", []byte("jpg"))
+	server.PutFile("/apps/photos/trip.mp4", []byte("mp4"))
+
+	runApp(t, a, exitOK, "search", "--dir", "photos", "--category", "3", "--download", "trip")
+	if stdout.String() != "/apps/photos/2023/trip.jpg\n" {
+		t.Fatalf("unexpected search output: %q", stdout)
+	}
+	if got, err := os.ReadFile("2023/trip.jpg"); err != nil || string(got) != "jpg" {
+		t.Fatalf("search hit not downloaded: %v", err)
+	}
+	runApp(t, a, exitUsage, "search")
+}
+
+func TestStatCommand(t *testing.T) {
+	server, a, stdout := newTestApp(t)
+	f := server.PutFile("/apps/data/a.txt", []byte("hello"))
+	server.Mkdir("/apps/data/sub")
+
+	runApp(t, a, exitOK, "stat", "data/a.txt", "data/sub")
+	for _, want := range []string{"path:         /apps/data/a.txt\n", "md5:          " + f.MD5 + "\n", "size:         5 (5B)\n", "type:         directory\n"} {
+		if !strings.Contains(stdout.String(), want) {
+			t.Fatalf("stat output missing %q:\n%s", want, stdout)
+		}
+	}
+
+	stdout.Reset()
+	runApp(t, a, exitOK, "stat", "--fs_id", "--output", "json", fmt.Sprint(f.FsID))
+	var meta baidu_api.FileMeta
+	if err := json.Unmarshal(stdout.Bytes(), &meta); err != nil || meta.Path != "/apps/data/a.txt" || meta.Size != 5 {
+		t.Fatalf("unexpected stat json %+v: %v", meta, err)
+	}
+
+	runApp(t, a, exitError, "stat", "data/missing")
+	runApp(t, a, exitUsage, "stat", "--fs_id", "abc")
+}
+
+func TestQuotaCommand(t *testing.T) {
+	server, a, stdout := newTestApp(t)
+	chdir(t, t.TempDir())
+	server.PutFile("/apps/data/a.txt", make([]byte, 1024))
+	server.SetQuota(4096)
+
+	runApp(t, a, exitOK, "whoami")
+	for _, want := range []string{"username:     fake_user\n", "vip_type:     2 (超级会员)\n", "used:         1.0K\n", "free:         3.0K\n"} {
+		if !strings.Contains(stdout.String(), want) {
+			t.Fatalf("whoami output missing %q:\n%s", want, stdout)
+		}
+	}
+	stdout.Reset()
+	runApp(t, a, exitOK, "quota", "--output", "json")
+	var quota struct {
+		Total, Used, Free int64
+	}
+	if err := json.Unmarshal(stdout.Bytes(), &quota); err != nil || quota.Total != 4096 || quota.Free != 3072 {
+		t.Fatalf("unexpected quota json %+v: %v", quota, err)
+	}
+
+	// 放不下时在预上传之前就拒绝
+	if err := os.WriteFile("big.bin", make([]byte, 4000), 0644); err != nil {
+		t.Fatal(err)
+	}
+	a.stderr = &bytes.Buffer{}
+	runApp(t, a, exitError, "upload", "big.bin")
+	if !strings.Contains(fmt.Sprint(a.stderr), "quota exceeded") || server.Requests("precreate") != 0 {
+		t.Fatalf("expected quota error before precreate, stderr: %s", a.stderr)
+	}
+	runApp(t, a, exitOK, "upload", "--check_quota=false", "big.bin")
+}
+
+func TestShell(t *testing.T) {
+	server, a, stdout := newTestApp(t)
+	chdir(t, t.TempDir())
+	server.PutFile("/apps/data/report.txt", []byte("report"))
+	server.PutFile("/apps/data/photos/cat.jpg", []byte("cat"))
+	if err := os.WriteFile("local.txt", []byte("local"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	a.stdin = strings.NewReader(strings.Join([]string{
+		"cd data",
+		"pwd",
+		"ls",
+		"cd photos",
+		"get cat.jpg",
+		"put local.txt",
+		"mv ../report.txt 'old report.txt'",
+		"ls",
+		"cd /nowhere",
+		"pwd",
+		"exit",
+		"pwd",
+	}, "\n"))
+	runApp(t, a, exitOK, "shell")
+	want := "/apps/data\n" +
+		"photos/\n" +
+		"report.txt\n" +
+		"cat.jpg\n" +
+		"local.txt\n" +
+		"old report.txt\n" +
+		"/apps/data/photos\n"
+	if stdout.String() != want {
+		t.Fatalf("unexpected shell output:\n%s", stdout)
+	}
+	if !strings.Contains(fmt.Sprint(a.stderr), "cd: ") {
+		t.Fatalf("expected cd error, stderr: %s", a.stderr)
+	}
+	if got, err := os.ReadFile("cat.jpg"); err != nil || string(got) != "cat" {
+		t.Fatalf("cat.jpg not downloaded: %v", err)
+	}
+	if _, ok := server.Stat("/apps/data/photos/local.txt"); !ok {
+		t.Fatal("local.txt not uploaded")
+	}
+}
+
+func TestShellComplete(t *testing.T) {
+	server, a, _ := newTestApp(t)
+	chdir(t, t.TempDir())
+	server.PutFile("/apps/data/photos/cat.jpg", nil)
+	server.PutFile("/apps/data/photos/car.jpg", nil)
+	server.PutFile("/apps/data/notes.txt", nil)
+	server.PutFile("/apps/data/my photos/a b.jpg", nil)
+	server.PutFile("/apps/data/two words.txt", nil)
+	if err := os.WriteFile("upload-me.txt", nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	client := baidu_api.NewClient("test-token", a.clientOpts...)
+	s := &shell{client: client, cwd: "/apps", cache: map[string][]*baidu_api.FileOrDir{}}
+
+	tests := []struct {
+		line string
+		want string
+	}{
+		{"mk", "mkdir "},
+		{"  ", "  "},
+		{"  mk", "  mkdir "},
+		{"ls da", "ls data/"},
+		{"ls data/ph", "ls data/photos/"},
+		{"get data/photos/c", "get data/photos/ca"},
+		{"get data/photos/cat", "get data/photos/cat.jpg "},
+		{"put up", "put upload-me.txt "},
+		{"ls x", "ls x"},
+		// 名字里有空格时补全的内容要转义，引号里补全时沿用引号
+		{"ls data/my", `ls data/my\ photos/`},
+		{`get data/my\ photos/a`, `get data/my\ photos/a\ b.jpg `},
+		{`get "data/my`, `get "data/my photos/`},
+		{`get "data/my photos/a`, `get "data/my photos/a b.jpg" `},
+		{"get 'data/tw", "get 'data/two words.txt' "},
+		{`get data/tw`, `get data/two\ words.txt `},
+	}
+	for _, test := range tests {
+		got, pos, ok := s.complete(context.Background(), test.line, len(test.line))
+		if !ok {
+			got, pos = test.line, len(test.line)
+		}
+		if got != test.want || pos != len(test.want) {
+			t.Errorf("complete(%q) = %q, %d, want %q", test.line, got, pos, test.want)
+		}
+		// 补全出完整文件名的行按执行时的规则分词，名字不会被拆开
+		if strings.Contains(test.want, "a b.jpg") {
+			if args, err := splitArgs(got); err != nil || args[len(args)-1] != "data/my photos/a b.jpg" {
+				t.Errorf("splitArgs(%q) = %q, %v", got, args, err)
+			}
+		}
+	}
+	// 补全用到的 4 个文件夹都被缓存，每个文件夹不满一页，要再取到空页才算取完
+	if n := server.Requests("list"); n != 8 {
+		t.Fatalf("expected 8 list requests, got %d", n)
+	}
+}
+
+func TestVerifyCommand(t *testing.T) {
+	server, a, stdout := newTestApp(t)
+	chdir(t, t.TempDir())
+	server.PutFile("/apps/data/a.txt", []byte("hello"))
+	server.PutFile("/apps/data/sub/b.txt", []byte("world"))
+	runApp(t, a, exitOK, "download", "data")
+
+	runApp(t, a, exitOK, "verify", "data")
+	if !strings.Contains(stdout.String(), "2 ok, 0 size only, 0 failed") {
+		t.Fatalf("unexpected verify output:\n%s", stdout)
+	}
+
+	// 本地文件被改坏或者删掉
+	if err := os.WriteFile(filepath.Join("data", "a.txt"), []byte("HELLO"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Remove(filepath.Join("data", "sub", "b.txt")); err != nil {
+		t.Fatal(err)
+	}
+	stdout.Reset()
+	a.stderr = &bytes.Buffer{}
+	runApp(t, a, exitError, "verify", "--output", "json", "data")
+	statuses := map[string]string{}
+	decoder := json.NewDecoder(stdout)
+	for decoder.More() {
+		var result verifyResult
+		if err := decoder.Decode(&result); err != nil {
+			t.Fatal(err)
+		}
+		statuses[result.Path] = result.Status
+	}
+	if statuses["/apps/data/a.txt"] != "mismatch" || statuses["/apps/data/sub/b.txt"] != "missing" {
+		t.Fatalf("unexpected verify results %v", statuses)
+	}
+
+	runApp(t, a, exitOK, "verify", "--redownload", "data")
+	got, err := os.ReadFile(filepath.Join("data", "a.txt"))
+	if err != nil || string(got) != "hello" {
+		t.Fatalf("a.txt not redownloaded: %q %v", got, err)
+	}
+	stdout.Reset()
+	runApp(t, a, exitOK, "verify", "data")
+	if !strings.Contains(stdout.String(), "2 ok, 0 size only, 0 failed") {
+		t.Fatalf("unexpected verify output after redownload:\n%s", stdout)
+	}
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"baidu_tool/baidu_api"
+	"context"
+	"flag"
+	"fmt"
+)
+
+// search 命令
+func (a *app) search(ctx context.Context, flagSet *flag.FlagSet, args []string) error {
+	var input struct {
+		Dir         string
+		Recursion   bool
+		Category    int
+		Download    bool
+		DownloadDir string
+		clientFlags
+	}
+	flagSet.StringVar(&input.Dir, "dir", "/apps", "在哪个网盘文件夹下搜索")
+	flagSet.BoolVar(&input.Recursion, "recursion", true, "搜索所有层级的下级")
+	flagSet.IntVar(&input.Category, "category", 0, "文件类型：1 视频 2 音频 3 图片 4 文档 5 应用 6 其他 7 种子，0 为不限制")
+	flagSet.BoolVar(&input.Download, "download", false, "下载搜索到的文件，保留相对于 dir 的目录结构")
+	flagSet.StringVar(&input.DownloadDir, "download_dir", "", "下载保存到的本地文件夹，默认当前目录")
+	input.clientFlags.register(flagSet)
+	rest, err := parse(flagSet, args, 1, 1)
+	if err != nil {
+		return err
+	}
+	if input.Category < 0 || input.Category > 7 {
+		return usageError{fmt.Errorf("unknown category %d", input.Category)}
+	}
+	client, err := a.newClient(flagSet, &input.clientFlags, baidu_api.WithDownloadDir(input.DownloadDir))
+	if err != nil {
+		return err
+	}
+
+	dir := remotePath(input.Dir)
+	list, err := client.Search(ctx, rest[0], baidu_api.SearchOptions{
+		Dir:       dir,
+		Recursion: input.Recursion,
+		Category:  input.Category,
+	})
+	if err != nil {
+		return err
+	}
+	if input.json() {
+		if err = printJSONList(a.stdout, list); err != nil {
+			return err
+		}
+	} else {
+		for _, item := range list {
+			fmt.Fprintln(a.stdout, item.Path)
+		}
+	}
+	if input.Download {
+		return downloadItems(ctx, client, outermost(list), dir)
+	}
+	return nil
+}
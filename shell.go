@@ -0,0 +1,514 @@
+package main
+
+import (
+	"baidu_tool/baidu_api"
+	"bufio"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"golang.org/x/term"
+	"io"
+	"os"
+	"path"
+	"slices"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// shellCommand 交互模式里的一个命令
+type shellCommand struct {
+	args  string
+	short string
+	run   func(s *shell, ctx context.Context, args []string) error
+	// local 参数是本地路径，补全时补全本地文件名
+	local bool
+}
+
+// shellCommands 交互模式的命令，help、exit 由 shell 自己处理
+var shellCommands = map[string]*shellCommand{
+	"cd":    {args: "[网盘文件夹]", short: "切换当前网盘文件夹，不传时回到 /apps", run: (*shell).cd},
+	"pwd":   {short: "显示当前网盘文件夹", run: (*shell).pwd},
+	"ls":    {args: "[-l] [网盘路径]", short: "列出文件夹中的内容", run: (*shell).ls},
+	"get":   {args: "<网盘路径>...", short: "下载到本地当前目录", run: (*shell).get},
+	"put":   {args: "<本地路径>...", short: "上传到当前网盘文件夹", run: (*shell).put, local: true},
+	"rm":    {args: "<网盘路径>...", short: "删除文件或文件夹", run: (*shell).rm},
+	"mv":    {args: "<源路径>... <目标路径>", short: "移动或重命名", run: (*shell).mv},
+	"mkdir": {args: "<网盘文件夹>...", short: "创建文件夹", run: (*shell).mkdir},
+}
+
+// shell 交互模式的状态
+type shell struct {
+	client *baidu_api.Client
+	// cwd 当前网盘文件夹
+	cwd string
+	// cache 列过的文件夹，改动网盘内容的命令执行后清空
+	cache  map[string][]*baidu_api.FileOrDir
+	stdout io.Writer
+	stderr io.Writer
+}
+
+// shell 命令
+func (a *app) shell(ctx context.Context, flagSet *flag.FlagSet, args []string) error {
+	var input clientFlags
+	input.register(flagSet)
+	if _, err := parse(flagSet, args, 0, 0); err != nil {
+		return err
+	}
+	client, err := a.newClient(flagSet, &input)
+	if err != nil {
+		return err
+	}
+	s := &shell{
+		client: client,
+		cwd:    "/apps",
+		cache:  map[string][]*baidu_api.FileOrDir{},
+		stdout: a.stdout,
+		stderr: a.stderr,
+	}
+
+	// 不是终端时，比如管道输入脚本，逐行读取执行
+	stdin, ok := a.stdin.(*os.File)
+	if !ok || !term.IsTerminal(int(stdin.Fd())) {
+		scanner := bufio.NewScanner(a.stdin)
+		for scanner.Scan() {
+			if s.exec(ctx, scanner.Text()) {
+				return nil
+			}
+		}
+		return scanner.Err()
+	}
+
+	fd := int(stdin.Fd())
+	terminal := term.NewTerminal(struct {
+		io.Reader
+		io.Writer
+	}{stdin, a.stdout}, "")
+	terminal.AutoCompleteCallback = func(line string, pos int, key rune) (string, int, bool) {
+		if key != '\t' {
+			return "", 0, false
+		}
+		return s.complete(ctx, line, pos)
+	}
+	for ctx.Err() == nil {
+		terminal.SetPrompt(s.cwd + "> ")
+		oldState, err := term.MakeRaw(fd)
+		if err != nil {
+			return err
+		}
+		line, err := terminal.ReadLine()
+		// 执行命令时恢复终端，进度条和输出才能正常显示
+		_ = term.Restore(fd, oldState)
+		if errors.Is(err, io.EOF) {
+			fmt.Fprintln(a.stdout)
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if s.exec(ctx, line) {
+			return nil
+		}
+	}
+	return ctx.Err()
+}
+
+// exec 执行一行命令，出错时打印错误后继续，返回是否要退出
+func (s *shell) exec(ctx context.Context, line string) bool {
+	args, err := splitArgs(line)
+	if err != nil {
+		fmt.Fprintln(s.stderr, err)
+		return false
+	}
+	if len(args) == 0 {
+		return false
+	}
+	switch args[0] {
+	case "exit", "quit":
+		return true
+	case "help":
+		s.help()
+		return false
+	}
+	cmd, ok := shellCommands[args[0]]
+	if !ok {
+		fmt.Fprintf(s.stderr, "unknown command %q, type help for a list\n", args[0])
+		return false
+	}
+	if err = cmd.run(s, ctx, args[1:]); err != nil {
+		fmt.Fprintf(s.stderr, "%s: %v\n", args[0], err)
+	}
+	return false
+}
+
+func (s *shell) help() {
+	names := make([]string, 0, len(shellCommands))
+	for name := range shellCommands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		cmd := shellCommands[name]
+		fmt.Fprintf(s.stdout, "  %-24s %s\n", strings.TrimSpace(name+" "+cmd.args), cmd.short)
+	}
+	fmt.Fprintf(s.stdout, "  %-24s %s\n", "exit", "退出")
+}
+
+// resolve 网盘路径，相对路径按当前文件夹处理
+func (s *shell) resolve(p string) string {
+	if strings.HasPrefix(p, "/") {
+		return path.Clean(p)
+	}
+	return path.Join(s.cwd, p)
+}
+
+// list 列出文件夹，列过的直接用缓存
+func (s *shell) list(ctx context.Context, dir string) ([]*baidu_api.FileOrDir, error) {
+	if list, ok := s.cache[dir]; ok {
+		return list, nil
+	}
+	list, err := s.client.ListDir(ctx, dir, baidu_api.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+	s.cache[dir] = list
+	return list, nil
+}
+
+// changed 网盘内容改变后清空缓存
+func (s *shell) changed() {
+	s.cache = map[string][]*baidu_api.FileOrDir{}
+}
+
+func (s *shell) cd(ctx context.Context, args []string) error {
+	if len(args) > 1 {
+		return errors.New("usage: cd [dir]")
+	}
+	dir := "/apps"
+	if len(args) == 1 {
+		dir = s.resolve(args[0])
+	}
+	// 能列出来才是存在的文件夹
+	if _, err := s.list(ctx, dir); err != nil {
+		return err
+	}
+	s.cwd = dir
+	return nil
+}
+
+func (s *shell) pwd(_ context.Context, _ []string) error {
+	fmt.Fprintln(s.stdout, s.cwd)
+	return nil
+}
+
+func (s *shell) ls(ctx context.Context, args []string) error {
+	long := false
+	if len(args) > 0 && args[0] == "-l" {
+		long, args = true, args[1:]
+	}
+	if len(args) > 1 {
+		return errors.New("usage: ls [-l] [path]")
+	}
+	dir := s.cwd
+	if len(args) == 1 {
+		dir = s.resolve(args[0])
+	}
+	list, err := s.list(ctx, dir)
+	if errors.Is(err, baidu_api.ErrPathNotFound) && dir != "/" {
+		// 可能是文件，到上一层找
+		siblings, parentErr := s.list(ctx, path.Dir(dir))
+		if parentErr != nil {
+			return err
+		}
+		list = nil
+		for _, item := range siblings {
+			if item.ServerFilename == path.Base(dir) {
+				list = append(list, item)
+			}
+		}
+		if list == nil {
+			return err
+		}
+	} else if err != nil {
+		return err
+	}
+	if long {
+		return printLongList(s.stdout, list, true)
+	}
+	for _, item := range list {
+		fmt.Fprintln(s.stdout, displayName(item))
+	}
+	return nil
+}
+
+func (s *shell) get(ctx context.Context, args []string) error {
+	if len(args) == 0 {
+		return errors.New("usage: get <path>...")
+	}
+	for _, p := range args {
+		if err := download(ctx, s.client, s.resolve(p)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *shell) put(ctx context.Context, args []string) error {
+	if len(args) == 0 {
+		return errors.New("usage: put <local path>...")
+	}
+	// 只能上传到 我的应用数据 下
+	if s.cwd != "/apps" && !strings.HasPrefix(s.cwd, "/apps/") {
+		return fmt.Errorf("can only upload under /apps, current directory is %s", s.cwd)
+	}
+	prefix := strings.TrimPrefix(strings.TrimPrefix(s.cwd, "/apps"), "/")
+	defer s.changed()
+	for _, p := range args {
+		if err := upload(ctx, s.client, p, prefix, true); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *shell) rm(ctx context.Context, args []string) error {
+	if len(args) == 0 {
+		return errors.New("usage: rm <path>...")
+	}
+	paths := make([]string, 0, len(args))
+	for _, p := range args {
+		paths = append(paths, s.resolve(p))
+	}
+	defer s.changed()
+	return s.client.Delete(ctx, paths)
+}
+
+func (s *shell) mv(ctx context.Context, args []string) error {
+	if len(args) < 2 {
+		return errors.New("usage: mv <source>... <target>")
+	}
+	sources, dest := args[:len(args)-1], s.resolve(args[len(args)-1])
+	destIsDir, err := isRemoteDir(ctx, s.client, dest)
+	if err != nil {
+		return err
+	}
+	if !destIsDir && len(sources) > 1 {
+		return fmt.Errorf("target %s is not a directory", dest)
+	}
+	resolved := make([]string, 0, len(sources))
+	for _, source := range sources {
+		resolved = append(resolved, s.resolve(source))
+	}
+	defer s.changed()
+	return s.client.Move(ctx, fileOperations(resolved, dest, destIsDir), baidu_api.OndupFail)
+}
+
+func (s *shell) mkdir(ctx context.Context, args []string) error {
+	if len(args) == 0 {
+		return errors.New("usage: mkdir <dir>...")
+	}
+	defer s.changed()
+	for _, p := range args {
+		if _, err := s.client.Mkdir(ctx, s.resolve(p)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// complete 补全光标前的词：第一个词补全命令名，之后的补全网盘文件名，put 补全本地文件名
+// 和执行命令时一样按引号和转义分词，补全的名字按光标所在的引号转义，名字里有空格也不会被拆开
+func (s *shell) complete(ctx context.Context, line string, pos int) (string, int, bool) {
+	before := line[:pos]
+	lexed := lexArgs(before)
+	wordStart, word := pos, ""
+	if lexed.inWord {
+		wordStart, word = lexed.start, lexed.current
+	}
+	var candidates []string
+	// 光标前只有空格时也是在输入命令名
+	if len(lexed.args) == 0 {
+		for name := range shellCommands {
+			candidates = append(candidates, name+" ")
+		}
+		candidates = append(candidates, "help ", "exit ")
+	} else {
+		dirPart, _ := path.Split(word)
+		if cmd, ok := shellCommands[lexed.args[0]]; ok && cmd.local {
+			candidates = localCandidates(dirPart)
+		} else {
+			candidates = s.remoteCandidates(ctx, dirPart)
+		}
+		for i := range candidates {
+			candidates[i] = dirPart + candidates[i]
+		}
+	}
+
+	var matches []string
+	for _, candidate := range candidates {
+		if strings.HasPrefix(candidate, word) {
+			matches = append(matches, candidate)
+		}
+	}
+	if len(matches) == 0 {
+		return "", 0, false
+	}
+	completion := commonPrefix(matches)
+	if len(completion) <= len(word) {
+		return "", 0, false
+	}
+	// 补全到完整的文件名时，最后的空格是参数之间的分隔，不属于名字
+	separator := ""
+	if slices.Contains(matches, completion) && strings.HasSuffix(completion, " ") {
+		completion, separator = strings.TrimSuffix(completion, " "), " "
+	}
+	text := quoteArg(completion, lexed.quote, separator != "") + separator
+	return before[:wordStart] + text + line[pos:], wordStart + len(text), true
+}
+
+// remoteCandidates 网盘文件夹下可以补全的名字，文件夹带 /，文件带空格
+func (s *shell) remoteCandidates(ctx context.Context, dirPart string) []string {
+	dir := s.cwd
+	if dirPart != "" {
+		dir = s.resolve(dirPart)
+	}
+	list, err := s.list(ctx, dir)
+	if err != nil {
+		return nil
+	}
+	candidates := make([]string, 0, len(list))
+	for _, item := range list {
+		if item.IsDir == 1 {
+			candidates = append(candidates, item.ServerFilename+"/")
+		} else {
+			candidates = append(candidates, item.ServerFilename+" ")
+		}
+	}
+	return candidates
+}
+
+// localCandidates 本地文件夹下可以补全的名字
+func localCandidates(dirPart string) []string {
+	dir := dirPart
+	if dir == "" {
+		dir = "."
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil
+	}
+	candidates := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		if entry.IsDir() {
+			candidates = append(candidates, entry.Name()+"/")
+		} else {
+			candidates = append(candidates, entry.Name()+" ")
+		}
+	}
+	return candidates
+}
+
+// commonPrefix 所有字符串共同的前缀
+func commonPrefix(list []string) string {
+	prefix := list[0]
+	for _, s := range list[1:] {
+		for !strings.HasPrefix(s, prefix) {
+			prefix = prefix[:len(prefix)-1]
+		}
+	}
+	// 不同的中文字可能有相同的开头字节，不能停在半个字上
+	for !utf8.ValidString(prefix) {
+		prefix = prefix[:len(prefix)-1]
+	}
+	return prefix
+}
+
+// splitArgs 按空格分割一行命令，支持单引号、双引号和反斜杠转义，文件名里可以有空格
+func splitArgs(line string) ([]string, error) {
+	lexed := lexArgs(line)
+	if lexed.quote != 0 || lexed.escaped {
+		return nil, errors.New("unterminated quote or escape")
+	}
+	if lexed.inWord {
+		lexed.args = append(lexed.args, lexed.current)
+	}
+	return lexed.args, nil
+}
+
+// lexedLine 分词到行尾时的状态，补全时行尾就是光标
+type lexedLine struct {
+	// args 已经结束的词，去掉了引号和转义
+	args []string
+	// inWord 行尾是否在一个词中间，current 是这个词到行尾的内容，start 是它在行中的开始位置
+	inWord  bool
+	current string
+	start   int
+	// quote 行尾所在的引号，escaped 行尾是否是没用掉的反斜杠
+	quote   rune
+	escaped bool
+}
+
+// lexArgs 按 splitArgs 的规则分词，未结束的引号和转义留给调用方处理
+func lexArgs(line string) lexedLine {
+	var lexed lexedLine
+	var current strings.Builder
+	// startWord 开始一个新词
+	startWord := func(i int) {
+		if !lexed.inWord {
+			lexed.inWord, lexed.start = true, i
+		}
+	}
+	for i, r := range line {
+		switch {
+		case lexed.escaped:
+			current.WriteRune(r)
+			lexed.escaped = false
+		case r == '\\' && lexed.quote != '\'':
+			startWord(i)
+			lexed.escaped = true
+		case lexed.quote != 0:
+			if r == lexed.quote {
+				lexed.quote = 0
+			} else {
+				current.WriteRune(r)
+			}
+		case r == '"' || r == '\'':
+			startWord(i)
+			lexed.quote = r
+		case r == ' ' || r == '\t':
+			if lexed.inWord {
+				lexed.args = append(lexed.args, current.String())
+				current.Reset()
+				lexed.inWord = false
+			}
+		default:
+			startWord(i)
+			current.WriteRune(r)
+		}
+	}
+	lexed.current = current.String()
+	return lexed
+}
+
+// quoteArg 把补全的内容写成 splitArgs 能原样读回的形式，光标在引号里时沿用这种引号，closed 时把引号闭合
+func quoteArg(arg string, quote rune, closed bool) string {
+	closing := ""
+	if closed {
+		closing = string(quote)
+	}
+	switch {
+	case quote == '"':
+		return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(arg) + closing
+	case quote == '\'' && !strings.ContainsRune(arg, '\''):
+		return "'" + arg + closing
+	}
+	var b strings.Builder
+	for _, r := range arg {
+		if strings.ContainsRune(" \t\\\"'", r) {
+			b.WriteRune('\\')
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
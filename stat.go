@@ -0,0 +1,119 @@
+package main
+
+import (
+	"baidu_tool/baidu_api"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// stat 命令
+func (a *app) stat(ctx context.Context, flagSet *flag.FlagSet, args []string) error {
+	var input struct {
+		FsID bool
+		clientFlags
+	}
+	flagSet.BoolVar(&input.FsID, "fs_id", false, "参数是 fs_id 而不是网盘路径")
+	input.clientFlags.register(flagSet)
+	rest, err := parse(flagSet, args, 1, -1)
+	if err != nil {
+		return err
+	}
+	var fsIDList []int64
+	if input.FsID {
+		for _, arg := range rest {
+			fsID, err := strconv.ParseInt(arg, 10, 64)
+			if err != nil {
+				return usageError{fmt.Errorf("invalid fs_id %q", arg)}
+			}
+			fsIDList = append(fsIDList, fsID)
+		}
+	}
+	client, err := a.newClient(flagSet, &input.clientFlags)
+	if err != nil {
+		return err
+	}
+
+	opts := baidu_api.FileMetasOptions{Thumb: true}
+	var metas []*baidu_api.FileMeta
+	if input.FsID {
+		if metas, err = client.FileMetas(ctx, fsIDList, opts); err != nil {
+			return err
+		}
+		if len(metas) < len(fsIDList) {
+			return fmt.Errorf("%d of %d fs_id: %w", len(fsIDList)-len(metas), len(fsIDList), baidu_api.ErrPathNotFound)
+		}
+	} else {
+		paths := make([]string, 0, len(rest))
+		for _, p := range rest {
+			paths = append(paths, remotePath(p))
+		}
+		if metas, err = client.StatPaths(ctx, paths, opts); err != nil {
+			return err
+		}
+	}
+
+	if input.json() {
+		encoder := json.NewEncoder(a.stdout)
+		for _, meta := range metas {
+			if err = encoder.Encode(meta); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	for i, meta := range metas {
+		if i > 0 {
+			fmt.Fprintln(a.stdout)
+		}
+		if err = printFileMeta(a.stdout, meta); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// printFileMeta 每行一项打印文件信息
+func printFileMeta(out io.Writer, meta *baidu_api.FileMeta) error {
+	w := tabwriter.NewWriter(out, 0, 0, 1, ' ', 0)
+	kind := "file"
+	if meta.IsDir == 1 {
+		kind = "directory"
+	}
+	formatTime := func(t int64) string {
+		return time.Unix(t, 0).Format(time.RFC3339)
+	}
+	fmt.Fprintf(w, "path:\t%s\n", meta.Path)
+	fmt.Fprintf(w, "fs_id:\t%d\n", meta.FsID)
+	fmt.Fprintf(w, "type:\t%s\n", kind)
+	if meta.IsDir == 0 {
+		fmt.Fprintf(w, "size:\t%d (%s)\n", meta.Size, humanSize(meta.Size))
+		fmt.Fprintf(w, "md5:\t%s\n", meta.MD5)
+	}
+	fmt.Fprintf(w, "category:\t%d\n", meta.Category)
+	fmt.Fprintf(w, "server_ctime:\t%s\n", formatTime(meta.ServerCtime))
+	fmt.Fprintf(w, "server_mtime:\t%s\n", formatTime(meta.ServerMtime))
+	fmt.Fprintf(w, "local_ctime:\t%s\n", formatTime(meta.LocalCtime))
+	fmt.Fprintf(w, "local_mtime:\t%s\n", formatTime(meta.LocalMtime))
+	if len(meta.Thumbs) > 0 {
+		names := make([]string, 0, len(meta.Thumbs))
+		for name := range meta.Thumbs {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			fmt.Fprintf(w, "thumb_%s:\t%s\n", name, meta.Thumbs[name])
+		}
+	}
+	if len(meta.BlockList) > 0 {
+		fmt.Fprintf(w, "block_list:\t%s\n", strings.Join(meta.BlockList, ","))
+	}
+	return w.Flush()
+}
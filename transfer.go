@@ -0,0 +1,199 @@
+package main
+
+import (
+	"baidu_tool/baidu_api"
+	"baidu_tool/config"
+	"baidu_tool/utils"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/vbauerster/mpb"
+	"os"
+	"path"
+	"strings"
+)
+
+// upload 命令
+func (a *app) upload(ctx context.Context, flagSet *flag.FlagSet, args []string) error {
+	var input struct {
+		BaiduPrefixPath string
+		ChunkSize       config.ByteSize
+		MaxFileSize     config.ByteSize
+		CheckQuota      bool
+		clientFlags
+	}
+	flagSet.StringVar(&input.BaiduPrefixPath, "prefix", "", "上传到百度网盘后所在的文件位置前缀部分，不传则直接在 我的应用数据 目录")
+	input.ChunkSize = config.ByteSize(utils.ChunkSize)
+	flagSet.Var(&input.ChunkSize, "chunk_size", "分片上传每片的大小，普通用户只能是 4MB")
+	input.MaxFileSize = config.ByteSize(utils.MaxSingleFileSize)
+	flagSet.Var(&input.MaxFileSize, "max_file_size", "单个网盘文件的大小上限，超过的本地文件拆成多个网盘文件上传")
+	flagSet.BoolVar(&input.CheckQuota, "check_quota", true, "上传前检查网盘剩余空间，放不下时直接拒绝")
+	input.clientFlags.register(flagSet)
+	rest, err := parse(flagSet, args, 1, 1)
+	if err != nil {
+		return err
+	}
+	// 大小也可能来自配置文件，叠加配置后、读取凭证前检查
+	if err = input.clientFlags.load(flagSet); err != nil {
+		return err
+	}
+	if input.ChunkSize <= 0 || input.MaxFileSize < input.ChunkSize {
+		return usageError{errors.New("chunk_size must be positive and max_file_size must not be less than chunk_size")}
+	}
+	client, err := a.newClient(flagSet, &input.clientFlags,
+		baidu_api.WithChunkSize(int64(input.ChunkSize)),
+		baidu_api.WithMaxSingleFileSize(int64(input.MaxFileSize)),
+	)
+	if err != nil {
+		return err
+	}
+	return upload(ctx, client, rest[0], input.BaiduPrefixPath, input.CheckQuota)
+}
+
+// download 命令
+func (a *app) download(ctx context.Context, flagSet *flag.FlagSet, args []string) error {
+	var input struct {
+		DownloadSliceSize config.ByteSize
+		DownloadDir       string
+		Verify            bool
+		clientFlags
+	}
+	input.DownloadSliceSize = config.ByteSize(baidu_api.MB50)
+	flagSet.Var(&input.DownloadSliceSize, "download_slice_size", "超过这个大小的文件分片下载")
+	flagSet.StringVar(&input.DownloadDir, "download_dir", "", "下载保存到的本地文件夹，默认当前目录")
+	flagSet.BoolVar(&input.Verify, "verify", true, "下载完成后用网盘记录的 md5 核对内容，不一致的文件删除后报错")
+	input.clientFlags.register(flagSet)
+	rest, err := parse(flagSet, args, 1, 1)
+	if err != nil {
+		return err
+	}
+	if err = input.clientFlags.load(flagSet); err != nil {
+		return err
+	}
+	if input.DownloadSliceSize <= 0 {
+		return usageError{errors.New("download_slice_size must be positive")}
+	}
+	client, err := a.newClient(flagSet, &input.clientFlags,
+		baidu_api.WithDownloadSliceSize(int64(input.DownloadSliceSize)),
+		baidu_api.WithDownloadDir(input.DownloadDir),
+		baidu_api.WithVerifyDownloads(input.Verify),
+	)
+	if err != nil {
+		return err
+	}
+	return download(ctx, client, remotePath(rest[0]))
+}
+
+// jigsaw 命令
+func (a *app) jigsaw(_ context.Context, flagSet *flag.FlagSet, args []string) error {
+	rest, err := parse(flagSet, args, 1, 1)
+	if err != nil {
+		return err
+	}
+	return utils.JigsawSlicedFiles(rest[0])
+}
+
+// remotePath 网盘路径，不是 / 开头的相对路径按 我的应用数据 即 /apps 下的路径处理
+func remotePath(p string) string {
+	if strings.HasPrefix(p, "/") {
+		return path.Clean(p)
+	}
+	return path.Join("/apps", p)
+}
+
+// upload 上传本地文件或文件夹到 我的应用数据/prefix 下，checkQuota 时先确认剩余空间放得下所有文件
+func upload(ctx context.Context, client *baidu_api.Client, localPath string, prefix string, checkQuota bool) error {
+	baiduPrefixPath := baidu_api.ParseBaiduPrefixPath(prefix)
+	// 如果前缀是 ./ ，可以去除
+	localPath = strings.TrimPrefix(localPath, "./")
+	// 本地的文件路径如果最后有 / 要去除
+	localPath = strings.TrimSuffix(localPath, "/")
+	// 解析出文件或文件夹下所有要上传的文件
+	filePathList, err := utils.GetFilePathListFromLocalPath(localPath)
+	if err != nil {
+		return err
+	}
+	if checkQuota {
+		var totalSize int64
+		for _, filePath := range filePathList {
+			fileInfo, err := os.Stat(filePath)
+			if err != nil {
+				return err
+			}
+			totalSize += fileInfo.Size()
+		}
+		if err = client.CheckQuota(ctx, totalSize); err != nil {
+			return err
+		}
+	}
+	// 多个文件的上传共用一个 mpb 进度
+	progress := mpb.New(mpb.WithOutput(client.Output))
+
+	return client.UploadFileOrDir(ctx, filePathList, baiduPrefixPath, progress)
+}
+
+// download 下载网盘中的文件或文件夹
+func download(ctx context.Context, client *baidu_api.Client, baiduPath string) error {
+	items, unusedPath, err := resolveDownload(ctx, client, baiduPath)
+	if err != nil {
+		return err
+	}
+	return client.DownloadFileOrDir(ctx, items, unusedPath)
+}
+
+// resolveDownload 找出下载 baiduPath 要下载的文件们，以及本地路径要去掉的网盘路径前缀
+func resolveDownload(ctx context.Context, client *baidu_api.Client, baiduPath string) ([]*baidu_api.FileOrDir, string, error) {
+	// 开始搜索，找文件信息
+	dirResp, err := client.GetFileOrDirResp(ctx, baiduPath, 0)
+	if err != nil {
+		return nil, "", err
+	}
+	// 如果文件夹信息中没有内容，那么要么是文件，要么是没有
+	if dirResp.List == nil || len(dirResp.List) == 0 {
+		// 退回上一层路径，用列表再次搜索
+		parentDir, file, err := utils.DivideDirAndFile(baiduPath)
+		if err != nil {
+			return nil, "", err
+		}
+		dirListResp, err := client.GetDirByList(ctx, parentDir)
+		if err != nil {
+			return nil, "", err
+		}
+		// 找到 list 里的 file，只下载这个 file
+		for _, item := range dirListResp.List {
+			if item.ServerFilename == file {
+				// 直接下载这个文件，不需要前面的目录
+				return []*baidu_api.FileOrDir{item}, parentDir, nil
+			}
+		}
+		return nil, "", fmt.Errorf("%s: %w", baiduPath, baidu_api.ErrPathNotFound)
+	}
+	// 下载文件夹时，不需要前面的冗余文件夹，找出该 path 的前面的文件夹
+	parentDir, _, err := utils.DivideDirAndFile(baiduPath)
+	if err != nil {
+		return nil, "", err
+	}
+	// 找到了，那么这是个文件夹，下载该文件夹和其内部所有文件
+	return dirResp.List, parentDir, nil
+}
+
+// downloadItems 下载列表或搜索得到的文件和文件夹，保留相对于 root 的目录结构，文件夹展开成里面的文件
+func downloadItems(ctx context.Context, client *baidu_api.Client, items []*baidu_api.FileOrDir, root string) error {
+	var files []*baidu_api.FileOrDir
+	for _, item := range items {
+		if item.IsDir == 0 {
+			files = append(files, item)
+			continue
+		}
+		dirResp, err := client.GetFileOrDirResp(ctx, item.Path, 0)
+		if err != nil {
+			return err
+		}
+		files = append(files, dirResp.List...)
+	}
+	if len(files) == 0 {
+		return nil
+	}
+	return client.DownloadFileOrDir(ctx, files, root)
+}
@@ -0,0 +1,249 @@
+package main
+
+import (
+	"baidu_tool/baidu_api"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"path"
+	"slices"
+	"sort"
+	"strings"
+	"text/tabwriter"
+)
+
+// duOrders du 的 --order 可选值
+var duOrders = []string{"size", "files", "name"}
+
+// dirUsage 一个文件夹递归统计的占用
+type dirUsage struct {
+	Path  string `json:"path"`
+	Size  int64  `json:"size"`
+	Files int    `json:"files"`
+	Dirs  int    `json:"dirs"`
+	// depth 在统计的根下第几层，根是 0
+	depth int
+}
+
+// du 命令
+func (a *app) du(ctx context.Context, flagSet *flag.FlagSet, args []string) error {
+	var input struct {
+		Depth   int
+		Order   string
+		Reverse bool
+		Human   bool
+		clientFlags
+	}
+	flagSet.IntVar(&input.Depth, "depth", -1, "只显示前几层文件夹，0 只显示总计，小于 0 不限制")
+	flagSet.StringVar(&input.Order, "order", "size", "排序方式：size 大小从大到小，files 文件数从多到少，name 路径")
+	flagSet.BoolVar(&input.Reverse, "r", false, "反向排列")
+	flagSet.BoolVar(&input.Human, "human", false, "大小显示为 KB、MB、GB")
+	input.clientFlags.register(flagSet)
+	rest, err := parse(flagSet, args, 0, 1)
+	if err != nil {
+		return err
+	}
+	if !slices.Contains(duOrders, input.Order) {
+		return usageError{fmt.Errorf("unknown order %q", input.Order)}
+	}
+	client, err := a.newClient(flagSet, &input.clientFlags)
+	if err != nil {
+		return err
+	}
+
+	root := "/apps"
+	if len(rest) == 1 {
+		root = remotePath(rest[0])
+	}
+	usages, err := walkUsage(ctx, client, root, nil)
+	if err != nil {
+		return err
+	}
+	list := make([]*dirUsage, 0, len(usages))
+	for _, usage := range usages {
+		if input.Depth < 0 || usage.depth <= input.Depth {
+			list = append(list, usage)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool {
+		x, y := list[i], list[j]
+		if input.Reverse {
+			x, y = y, x
+		}
+		switch {
+		case input.Order == "size" && x.Size != y.Size:
+			return x.Size > y.Size
+		case input.Order == "files" && x.Files != y.Files:
+			return x.Files > y.Files
+		}
+		return x.Path < y.Path
+	})
+
+	if input.json() {
+		encoder := json.NewEncoder(a.stdout)
+		for _, usage := range list {
+			if err = encoder.Encode(usage); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	w := tabwriter.NewWriter(a.stdout, 0, 0, 2, ' ', tabwriter.AlignRight)
+	for _, usage := range list {
+		fmt.Fprintf(w, "%s\t%d\t %s\n", formatSize(usage.Size, input.Human), usage.Files, usage.Path)
+	}
+	return w.Flush()
+}
+
+// treeNode tree 的 json 输出，文件夹的大小是递归统计的
+type treeNode struct {
+	Path     string      `json:"path"`
+	Name     string      `json:"name"`
+	IsDir    bool        `json:"isdir"`
+	Size     int64       `json:"size"`
+	Files    int         `json:"files,omitempty"`
+	Children []*treeNode `json:"children,omitempty"`
+}
+
+// tree 命令
+func (a *app) tree(ctx context.Context, flagSet *flag.FlagSet, args []string) error {
+	var input struct {
+		Depth int
+		Human bool
+		clientFlags
+	}
+	flagSet.IntVar(&input.Depth, "depth", -1, "只显示前几层，小于 0 不限制")
+	flagSet.BoolVar(&input.Human, "human", false, "大小显示为 KB、MB、GB")
+	input.clientFlags.register(flagSet)
+	rest, err := parse(flagSet, args, 0, 1)
+	if err != nil {
+		return err
+	}
+	client, err := a.newClient(flagSet, &input.clientFlags)
+	if err != nil {
+		return err
+	}
+
+	root := "/apps"
+	if len(rest) == 1 {
+		root = remotePath(rest[0])
+	}
+	// 要画出层级只能把整棵树放在内存里
+	children := map[string][]*baidu_api.FileOrDir{}
+	usages, err := walkUsage(ctx, client, root, func(item *baidu_api.FileOrDir) {
+		parent := path.Dir(item.Path)
+		children[parent] = append(children[parent], item)
+	})
+	if err != nil {
+		return err
+	}
+	for _, list := range children {
+		// 文件夹在前，再按名字
+		sort.Slice(list, func(i, j int) bool {
+			if list[i].IsDir != list[j].IsDir {
+				return list[i].IsDir > list[j].IsDir
+			}
+			return list[i].ServerFilename < list[j].ServerFilename
+		})
+	}
+
+	var build func(p string, name string, depth int) *treeNode
+	build = func(p string, name string, depth int) *treeNode {
+		usage := usages[p]
+		node := &treeNode{Path: p, Name: name, IsDir: true, Size: usage.Size, Files: usage.Files}
+		if input.Depth >= 0 && depth >= input.Depth {
+			return node
+		}
+		for _, item := range children[p] {
+			if item.IsDir == 1 {
+				node.Children = append(node.Children, build(item.Path, item.ServerFilename, depth+1))
+			} else {
+				node.Children = append(node.Children, &treeNode{Path: item.Path, Name: item.ServerFilename, Size: item.Size})
+			}
+		}
+		return node
+	}
+	rootNode := build(root, root, 0)
+	if input.json() {
+		return json.NewEncoder(a.stdout).Encode(rootNode)
+	}
+
+	fmt.Fprintf(a.stdout, "%s (%s)\n", rootNode.Name, formatSize(rootNode.Size, input.Human))
+	var dirs, files int
+	var printNode func(node *treeNode, indent string)
+	printNode = func(node *treeNode, indent string) {
+		for i, child := range node.Children {
+			branch, next := "├── ", "│   "
+			if i == len(node.Children)-1 {
+				branch, next = "└── ", "    "
+			}
+			name := child.Name
+			if child.IsDir {
+				name += "/"
+				dirs++
+			} else {
+				files++
+			}
+			fmt.Fprintf(a.stdout, "%s%s%s (%s)\n", indent, branch, name, formatSize(child.Size, input.Human))
+			printNode(child, indent+next)
+		}
+	}
+	printNode(rootNode, "")
+	fmt.Fprintf(a.stdout, "\n%d directories, %d files\n", dirs, files)
+	return nil
+}
+
+// walkUsage 递归列出 root，统计它和下面每个文件夹的大小、文件数和文件夹数，visit 不为 nil 时每一项都交给它
+func walkUsage(ctx context.Context, client *baidu_api.Client, root string, visit func(*baidu_api.FileOrDir)) (map[string]*dirUsage, error) {
+	usages := map[string]*dirUsage{root: {Path: root}}
+	usageOf := func(dir string) *dirUsage {
+		usage, ok := usages[dir]
+		if !ok {
+			usage = &dirUsage{Path: dir, depth: depthBelow(root, dir)}
+			usages[dir] = usage
+		}
+		return usage
+	}
+	it := client.ListAll(ctx, root, 0)
+	for it.Next() {
+		item := it.Item()
+		if visit != nil {
+			visit(item)
+		}
+		if item.IsDir == 1 {
+			usageOf(item.Path)
+		}
+		// 计入每一层上级文件夹，直到 root
+		for dir := path.Dir(item.Path); ; dir = path.Dir(dir) {
+			usage := usageOf(dir)
+			if item.IsDir == 1 {
+				usage.Dirs++
+			} else {
+				usage.Size += item.Size
+				usage.Files++
+			}
+			if dir == root || dir == "/" {
+				break
+			}
+		}
+	}
+	return usages, it.Err()
+}
+
+// depthBelow p 在 root 下第几层
+func depthBelow(root string, p string) int {
+	if p == root {
+		return 0
+	}
+	rel := strings.TrimPrefix(strings.TrimPrefix(p, root), "/")
+	return strings.Count(rel, "/") + 1
+}
+
+// formatSize 显示大小，human 时按 1024 进位
+func formatSize(size int64, human bool) string {
+	if human {
+		return humanSize(size)
+	}
+	return fmt.Sprint(size)
+}
@@ -1,9 +1,11 @@
 package utils
 
 import (
+	"context"
 	"crypto/md5"
 	"errors"
 	"fmt"
+	"io"
 	"log"
 	"os"
 	"path/filepath"
@@ -11,7 +13,10 @@ import (
 	"strings"
 )
 
+// MaxSingleFileSize 默认的单个网盘文件大小上限，超过的本地文件会拆成多个网盘文件上传
 const MaxSingleFileSize int64 = 1024 * 1024 * 1024
+
+// ChunkSize 默认的分片上传每片大小，普通用户百度只接受 4MB
 const ChunkSize int64 = 4 * 1024 * 1024
 
 // GetFilePathListFromLocalPath 列表形式返回文件或者文件夹下所有文件的路径
@@ -45,19 +50,24 @@ type SlicedFileByte struct {
 	Bytes []byte
 }
 
-// SliceFilePushToChan 把文件一块块切割后推入给好的 channel，所以要使用协程来运行该函数
-func SliceFilePushToChan(localFilePath string, slicedFileByteChan chan *SlicedFileByte, sequence int, fileSize int64) (err error) {
+// SliceFilePushToChan 把文件按 chunkSize 一块块切割后推入给好的 channel，所以要使用协程来运行该函数
+// sequence 不为 0 时只切割第 sequence 个 maxSingleFileSize 大小的部分
+// 无论成功与否，结束时都会关闭 channel，ctx 被取消时停止推送
+func SliceFilePushToChan(ctx context.Context, localFilePath string, slicedFileByteChan chan *SlicedFileByte, sequence int, fileSize int64, chunkSize int64, maxSingleFileSize int64) (err error) {
+	// 发送完毕后，由发送端关闭信道
+	defer close(slicedFileByteChan)
+
 	// Try to read the file
 	file, err := os.Open(localFilePath)
 	if err != nil {
-		log.Fatal("error trying to open the file specified:", err)
+		return fmt.Errorf("error trying to open the file specified: %w", err)
 	}
 	defer file.Close()
 
 	var fullFileSize int64
 	if sequence != 0 {
 		fullFileSize = fileSize
-		if _, err = file.Seek(int64(sequence-1)*MaxSingleFileSize, 0); err != nil {
+		if _, err = file.Seek(int64(sequence-1)*maxSingleFileSize, 0); err != nil {
 			return err
 		}
 	} else {
@@ -67,8 +77,8 @@ func SliceFilePushToChan(localFilePath string, slicedFileByteChan chan *SlicedFi
 		}
 		fullFileSize = fileInfo.Size()
 	}
-	sliceFileNum := fullFileSize / ChunkSize
-	lastSize := fullFileSize % ChunkSize
+	sliceFileNum := fullFileSize / chunkSize
+	lastSize := fullFileSize % chunkSize
 	// 不能整除，意味着还有一个碎文件
 	if lastSize != 0 {
 		sliceFileNum++
@@ -81,37 +91,33 @@ func SliceFilePushToChan(localFilePath string, slicedFileByteChan chan *SlicedFi
 		slicedFileByte := new(SlicedFileByte)
 		slicedFileByte.Index = int(i)
 
-		slicedFileByte.Bytes = make([]byte, ChunkSize)
+		slicedFileByte.Bytes = make([]byte, chunkSize)
 		// 最后一个文件的 bytes 坑位切换成大小
 		if lastSize != 0 && i == sliceFileNum-1 {
 			slicedFileByte.Bytes = make([]byte, lastSize)
 		}
 
 		// 读取分块字节
-		if _, err = file.Read(slicedFileByte.Bytes); err != nil {
-			log.Fatal(err)
-			return
+		if _, err = io.ReadFull(file, slicedFileByte.Bytes); err != nil {
+			return err
 		}
 
-		if len(slicedFileByte.Bytes) == 0 {
-			fmt.Printf("%+v", slicedFileByte)
+		select {
+		case slicedFileByteChan <- slicedFileByte:
+		case <-ctx.Done():
+			return ctx.Err()
 		}
-
-		slicedFileByteChan <- slicedFileByte
 	}
 
-	// 发送完毕后，由发送端关闭信道
-	close(slicedFileByteChan)
-
 	return nil
 }
 
 // SliceFileNotSave 分片不保存，省空间，只提供 碎片文件的 md5 列表，为百度 preCreate 接口服务
-func SliceFileNotSave(localFilePath string, sequence int, fileSize int64) (md5List []string, err error) {
+func SliceFileNotSave(ctx context.Context, localFilePath string, sequence int, fileSize int64, chunkSize int64, maxSingleFileSize int64) (md5List []string, err error) {
 	// Try to read the file
 	file, err := os.Open(localFilePath)
 	if err != nil {
-		log.Fatal("error trying to open the file specified:", err)
+		return nil, fmt.Errorf("error trying to open the file specified: %w", err)
 	}
 	defer file.Close()
 
@@ -120,7 +126,7 @@ func SliceFileNotSave(localFilePath string, sequence int, fileSize int64) (md5Li
 	if sequence != 0 {
 		fullFileSize = fileSize
 		// 使用 seek 调整，来决定读取第几个
-		if _, err = file.Seek(int64(sequence-1)*MaxSingleFileSize, 0); err != nil {
+		if _, err = file.Seek(int64(sequence-1)*maxSingleFileSize, 0); err != nil {
 			return nil, err
 		}
 	} else {
@@ -131,23 +137,27 @@ func SliceFileNotSave(localFilePath string, sequence int, fileSize int64) (md5Li
 		fullFileSize = fileInfo.Size()
 	}
 
-	sliceFileNum := fullFileSize / ChunkSize
-	lastSize := fullFileSize % ChunkSize
+	sliceFileNum := fullFileSize / chunkSize
+	lastSize := fullFileSize % chunkSize
 	// 不能整除，意味着还有一个碎文件
 	if lastSize != 0 {
 		sliceFileNum++
 	}
 
 	// 文件坑位为分快大小
-	b := make([]byte, ChunkSize)
+	b := make([]byte, chunkSize)
 	for i := int64(0); i < sliceFileNum; i++ {
+		// 超大文件算 md5 很久，中途可以取消
+		if err = ctx.Err(); err != nil {
+			return nil, err
+		}
 		// 最后一个文件的 bytes 坑位切换成大小
 		if lastSize != 0 && i == sliceFileNum-1 {
 			b = make([]byte, lastSize)
 		}
 
 		// 读取分块字节
-		if _, err = file.Read(b); err != nil {
+		if _, err = io.ReadFull(file, b); err != nil {
 			return
 		}
 
@@ -218,7 +228,6 @@ func SliceFileAndSave(localFilePath string) (slicedFilePaths []string, blockList
 
 		f, err := os.OpenFile(sliceFileName, os.O_CREATE|os.O_WRONLY, os.ModePerm)
 		if err != nil {
-			fmt.Println(err)
 			return nil, nil, err
 		}
 		_, err = f.Write(b)
@@ -302,3 +311,33 @@ func JigsawSlicedFiles(slicedFilesDir string) error {
 	fmt.Printf("文件拼接好了 %s\n", fmt.Sprintf("%s/%s", slicedFilesDir, fileName))
 	return nil
 }
+
+// WriteFileAtomic 先写临时文件再改名，写到一半崩溃也不会留下残缺的文件
+func WriteFileAtomic(filePath string, data []byte, perm os.FileMode) error {
+	dir := filepath.Dir(filePath)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return err
+	}
+	tempFile, err := os.CreateTemp(dir, filepath.Base(filePath)+".tmp*")
+	if err != nil {
+		return err
+	}
+	tempPath := tempFile.Name()
+	// 改名成功后临时文件已不存在，删除会失败，不影响
+	defer os.Remove(tempPath)
+	if _, err = tempFile.Write(data); err != nil {
+		tempFile.Close()
+		return err
+	}
+	if err = tempFile.Sync(); err != nil {
+		tempFile.Close()
+		return err
+	}
+	if err = tempFile.Close(); err != nil {
+		return err
+	}
+	if err = os.Chmod(tempPath, perm); err != nil {
+		return err
+	}
+	return os.Rename(tempPath, filePath)
+}
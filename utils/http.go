@@ -7,20 +7,37 @@ import (
 	"net/http"
 )
 
+// HTTPStatusError 返回的 http 状态码不是成功状态
+type HTTPStatusError struct {
+	StatusCode int
+	Body       []byte
+}
+
+func (e *HTTPStatusError) Error() string {
+	body := e.Body
+	if len(body) > 200 {
+		body = body[:200]
+	}
+	return fmt.Sprintf("http status %d: %s", e.StatusCode, body)
+}
+
+// DoHttpRequest 发出请求并把返回体解析到 respVar，错误只返回给调用方，不在这里打印，避免混进 json 输出
 func DoHttpRequest[T any](respVar *T, client *http.Client, req *http.Request) (*T, error) {
 	resp, err := client.Do(req)
 	if err != nil {
-		fmt.Printf("client do err: %v\n", err)
 		return respVar, err
 	}
 	defer resp.Body.Close()
 	respBts, err := io.ReadAll(resp.Body)
 	if err != nil {
-		fmt.Printf("io readAll body err: %v\n", err)
 		return respVar, err
 	}
+	if resp.StatusCode >= 400 {
+		// 错误返回体里也可能有错误码，尽量解析出来给调用方
+		_ = json.Unmarshal(respBts, respVar)
+		return respVar, &HTTPStatusError{StatusCode: resp.StatusCode, Body: respBts}
+	}
 	if err = json.Unmarshal(respBts, respVar); err != nil {
-		fmt.Printf("json unmarshal err: %v\n", err)
 		return respVar, err
 	}
 	return respVar, nil
@@ -3,24 +3,20 @@ package utils
 import (
 	"crypto/md5"
 	"fmt"
+	"io"
 	"os"
 )
 
+// FileToMd5 计算本地文件内容的 md5，边读边算，大文件也不会全部读进内存
 func FileToMd5(localFilePath string) (md5res string, err error) {
 	f, err := os.OpenFile(localFilePath, os.O_RDONLY, 0755)
 	if err != nil {
 		return "", err
 	}
 	defer f.Close()
-	// 获取文件大小
-	fileInfo, err := f.Stat()
-	if err != nil {
-		return "", err
-	}
-	fileBts := make([]byte, fileInfo.Size())
-	_, err = f.Read(fileBts)
-	if err != nil {
+	hash := md5.New()
+	if _, err = io.Copy(hash, f); err != nil {
 		return "", err
 	}
-	return fmt.Sprintf("%x", md5.Sum(fileBts)), nil
+	return fmt.Sprintf("%x", hash.Sum(nil)), nil
 }
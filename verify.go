@@ -0,0 +1,120 @@
+package main
+
+import (
+	"baidu_tool/baidu_api"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+)
+
+// verifyResult verify 一个文件的核对结果
+type verifyResult struct {
+	Path      string `json:"path"`
+	LocalPath string `json:"local_path"`
+	Status    string `json:"status"`
+}
+
+// verify 命令
+func (a *app) verify(ctx context.Context, flagSet *flag.FlagSet, args []string) error {
+	var input struct {
+		DownloadDir string
+		Redownload  bool
+		clientFlags
+	}
+	flagSet.StringVar(&input.DownloadDir, "download_dir", "", "下载时保存到的本地文件夹，默认当前目录")
+	flagSet.BoolVar(&input.Redownload, "redownload", false, "重新下载缺少或核对不通过的文件")
+	input.clientFlags.register(flagSet)
+	rest, err := parse(flagSet, args, 1, 1)
+	if err != nil {
+		return err
+	}
+	client, err := a.newClient(flagSet, &input.clientFlags, baidu_api.WithDownloadDir(input.DownloadDir))
+	if err != nil {
+		return err
+	}
+
+	// 和 download 一样找出文件和它们的本地路径
+	items, unusedPath, err := resolveDownload(ctx, client, remotePath(rest[0]))
+	if err != nil {
+		return err
+	}
+	// 网盘返回的分块列表决定 md5 能不能用来核对
+	blockLists, err := fileBlockLists(ctx, client, items)
+	if err != nil {
+		return err
+	}
+	var failed []*baidu_api.FileOrDir
+	var ok, sizeOnly int
+	encoder := json.NewEncoder(a.stdout)
+	for _, item := range items {
+		if item.IsDir == 1 {
+			continue
+		}
+		if err = ctx.Err(); err != nil {
+			return err
+		}
+		localPath := client.LocalPath(item.Path, unusedPath)
+		status, err := baidu_api.VerifyLocalFile(localPath, item.Size, item.MD5, blockLists[item.FsId])
+		if err != nil {
+			return err
+		}
+		switch status {
+		case baidu_api.VerifyOK:
+			ok++
+		case baidu_api.VerifySizeOnly:
+			sizeOnly++
+		default:
+			failed = append(failed, item)
+		}
+		if input.json() {
+			if err = encoder.Encode(verifyResult{Path: item.Path, LocalPath: localPath, Status: status}); err != nil {
+				return err
+			}
+		} else {
+			fmt.Fprintf(a.stdout, "%s: %s\n", localPath, status)
+		}
+	}
+	if !input.json() {
+		fmt.Fprintf(a.stdout, "\n%d ok, %d size only, %d failed\n", ok, sizeOnly, len(failed))
+	}
+	if len(failed) == 0 {
+		return nil
+	}
+	if !input.Redownload {
+		return fmt.Errorf("%d files failed verification", len(failed))
+	}
+
+	// 大小一样的文件下载时会被跳过，先删掉核对不通过的
+	for _, item := range failed {
+		if err = os.Remove(client.LocalPath(item.Path, unusedPath)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return client.DownloadFileOrDir(ctx, failed, unusedPath)
+}
+
+// fileBlockLists 用 filemetas 查询文件们的分块 md5 列表，百度没返回的文件没有记录
+func fileBlockLists(ctx context.Context, client *baidu_api.Client, items []*baidu_api.FileOrDir) (map[int64][]string, error) {
+	var fsIDList []int64
+	for _, item := range items {
+		if item.IsDir == 0 {
+			fsIDList = append(fsIDList, item.FsId)
+		}
+	}
+	blockLists := map[int64][]string{}
+	if len(fsIDList) == 0 {
+		return blockLists, nil
+	}
+	metas, err := client.FileMetas(ctx, fsIDList, baidu_api.FileMetasOptions{})
+	if err != nil {
+		return nil, err
+	}
+	for _, meta := range metas {
+		if len(meta.BlockList) > 0 {
+			blockLists[meta.FsID] = meta.BlockList
+		}
+	}
+	return blockLists, nil
+}